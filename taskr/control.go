@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/influx6/clis/taskr/tasks"
+	fcontext "github.com/influx6/faux/context"
+	"github.com/influx6/fractals/fhttp"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// controlDir is the directory within the user runtime directory, else the user
+// cache directory, which the control socket of each project is created in.
+const controlDir = "taskr"
+
+// controlHost defines the host named by requests of taskr ctl.
+const controlHost = "taskr"
+
+// errNotLocal is returned when a control request was sent by a web page.
+var errNotLocal = errors.New("Control requests are only accepted from local clients")
+
+// controlNetwork returns the network and address to use for the giving
+// control address, where a host:port address is served over tcp and any other
+// address is taken as the path of a unix socket. As the control endpoint has no
+// authentication, a tcp address must be a loopback address, with a bare :port
+// served on 127.0.0.1.
+func controlNetwork(addr string) (string, string, error) {
+	if strings.HasPrefix(addr, "tcp://") {
+		addr = strings.TrimPrefix(addr, "tcp://")
+	} else if strings.Contains(addr, "/") || !strings.Contains(addr, ":") {
+		return "unix", addr, nil
+	}
+
+	addr = localAddr(addr)
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !isLoopback(host) {
+		return "", "", fmt.Errorf("Control address %q must be a loopback address such as 127.0.0.1:7071", addr)
+	}
+
+	return "tcp", addr, nil
+}
+
+// localAddr returns the giving host:port address with a missing host set to
+// 127.0.0.1, so a bare :port is only reachable from this machine.
+func localAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + addr
+	}
+
+	return addr
+}
+
+// isLoopback returns true/false if the giving host names a loopback address.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// controlAddr returns the control address from the context, defaulting to a
+// socket for the project of the tasks file within the user runtime directory,
+// else the user cache directory, keeping it out of the project.
+func controlAddr(ctx *cli.Context) (string, error) {
+	if addr := ctx.String("control"); addr != "" {
+		return addr, nil
+	}
+
+	// The name of the project is left out, as socket paths are limited to
+	// about a hundred bytes.
+	_, hash, err := projectID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		if dir, err = os.UserCacheDir(); err != nil {
+			return "", err
+		}
+	}
+
+	return filepath.Join(dir, controlDir, hash+".sock"), nil
+}
+
+// localOnly returns a handler which refuses requests sent by web pages, which
+// carry an Origin header, or a Host other than taskr ctl's or a loopback
+// address when sent through DNS rebinding, so only local clients reach the
+// giving handler.
+func localOnly(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if r.Header.Get("Origin") != "" || (host != controlHost && !isLoopback(host)) {
+			fhttp.RenderErrorWithStatus(http.StatusForbidden, errNotLocal, r, w)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// serveControl serves the control endpoint of the series on the giving
+// address, returning a function to shut it down.
+func serveControl(addr string, series *tasks.TsonSeries) (func(), error) {
+	network, address, err := controlNetwork(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "unix" {
+		if err := os.MkdirAll(filepath.Dir(address), 0700); err != nil {
+			return nil, err
+		}
+
+		// Remove a socket left by a previous run which no longer accepts
+		// connections.
+		if conn, err := net.Dial(network, address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("Control socket %q already in use by another taskr", address)
+		}
+
+		os.Remove(address)
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	drive := fhttp.Drive()()
+	routeControl(drive, "", series)
+
+	server := &http.Server{Handler: localOnly(drive)}
+	go server.Serve(listener)
+
+	return func() {
+		server.Close()
+
+		if network == "unix" {
+			os.Remove(address)
+		}
+	}, nil
+}
+
+// routeControl adds the http routes which expose the control commands for the
+// series to the drive, with each path starting with the giving prefix.
+func routeControl(drive *fhttp.HTTPDrive, prefix string, series *tasks.TsonSeries) {
+	route := fhttp.Route(drive)
+
+	route(fhttp.Endpoint{
+		Path:   prefix + "/status",
+		Method: "GET",
+		Action: func(ctx fcontext.Context, rw *fhttp.Request) error {
+			rw.Respond(http.StatusOK, series.Status())
+			return nil
+		},
+	})
+
+	route(fhttp.Endpoint{
+		Path:   prefix + "/restart",
+		Method: "POST",
+		Action: func(ctx fcontext.Context, rw *fhttp.Request) error {
+			if err := series.Restart(rw.Req.URL.Query().Get("name")); err != nil {
+				rw.RespondError(http.StatusNotFound, err)
+				return nil
+			}
+
+			rw.Respond(http.StatusNoContent, nil)
+			return nil
+		},
+	})
+
+	route(fhttp.Endpoint{
+		Path:   prefix + "/stop",
+		Method: "POST",
+		Action: func(ctx fcontext.Context, rw *fhttp.Request) error {
+			go series.Stop()
+			rw.Respond(http.StatusNoContent, nil)
+			return nil
+		},
+	})
+
+	route(fhttp.Endpoint{
+		Path:   prefix + "/pause",
+		Method: "POST",
+		Action: func(ctx fcontext.Context, rw *fhttp.Request) error {
+			series.Pause()
+			rw.Respond(http.StatusNoContent, nil)
+			return nil
+		},
+	})
+
+	route(fhttp.Endpoint{
+		Path:   prefix + "/resume",
+		Method: "POST",
+		Action: func(ctx fcontext.Context, rw *fhttp.Request) error {
+			series.Resume()
+			rw.Respond(http.StatusNoContent, nil)
+			return nil
+		},
+	})
+
+	route(fhttp.Endpoint{
+		Path:   prefix + "/tail",
+		Method: "GET",
+		Action: func(ctx fcontext.Context, rw *fhttp.Request) error {
+			return tailSeries(rw, series, rw.Req.URL.Query().Get("name"))
+		},
+	})
+}
+
+// tailObserver sends the output of the Tsons tailed by a client into logs,
+// dropping output the client can not keep up with.
+type tailObserver struct {
+	tasks.NopObserver
+	name string
+	logs chan string
+}
+
+// Log implements the tasks.Observer interface.
+func (to tailObserver) Log(tson string, text string) {
+	if to.name != "" && to.name != tson {
+		return
+	}
+
+	select {
+	case to.logs <- text:
+	default:
+	}
+}
+
+// tailSeries streams the output of all Tsons in the series, or only the Tson
+// with the giving name, until the client disconnects.
+func tailSeries(rw *fhttp.Request, series *tasks.TsonSeries, name string) error {
+	if name != "" {
+		if _, err := series.Find(name); err != nil {
+			rw.RespondError(http.StatusNotFound, err)
+			return nil
+		}
+	}
+
+	observer := tailObserver{name: name, logs: make(chan string, eventBuffer)}
+	defer series.Observe(observer)()
+
+	done := rw.Req.Context().Done()
+
+	rw.Res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Res.WriteHeader(http.StatusOK)
+	rw.Res.Flush()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case text := <-observer.logs:
+			if _, err := io.WriteString(rw.Res, text); err != nil {
+				return nil
+			}
+
+			rw.Res.Flush()
+		}
+	}
+}
+
+//==============================================================================
+
+// controlClient returns a http client which connects to the control endpoint
+// at the giving address.
+func controlClient(addr string) (*http.Client, error) {
+	network, address, err := controlNetwork(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+		},
+	}, nil
+}
+
+// controlCall sends a request for the giving control command to the running
+// taskr, returning the response if successful.
+func controlCall(ctx *cli.Context, method string, command string, query url.Values) (*http.Response, error) {
+	addr, err := controlAddr(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := controlClient(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, "http://"+controlHost+"/"+command+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to reach running taskr at %q: %s", addr, err)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		defer res.Body.Close()
+
+		var jerr fhttp.JSONError
+		if err := json.NewDecoder(res.Body).Decode(&jerr); err != nil || jerr.Error == "" {
+			return nil, fmt.Errorf("Control command %q failed: %s", command, res.Status)
+		}
+
+		return nil, errors.New(jerr.Error)
+	}
+
+	return res, nil
+}
+
+// controlCommand returns a cli action which sends the giving command with no
+// response body expected.
+func controlCommand(command string) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		res, err := controlCall(ctx, "POST", command, nil)
+		if err != nil {
+			return err
+		}
+
+		return res.Body.Close()
+	}
+}
+
+func ctlStatus(ctx *cli.Context) error {
+	res, err := controlCall(ctx, "GET", "status", nil)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	var status []tasks.TsonStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "TSON\tTASK\tSTATUS\tEXIT\tDURATION")
+
+	for _, tson := range status {
+		name := tson.Name
+		if tson.Paused {
+			name += " (paused)"
+		}
+
+		for _, mt := range tson.Tasks {
+			for _, res := range mt.Before {
+				printResult(tw, name, res)
+			}
+
+			printResult(tw, name, mt.Main)
+
+			for _, res := range mt.After {
+				printResult(tw, name, res)
+			}
+		}
+
+		for _, res := range tson.Teardown {
+			printResult(tw, name, res)
+		}
+
+		for _, matrix := range tson.Matrices {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t\t\n", name, matrix.Name, matrix)
+		}
+	}
+
+	return nil
+}
+
+// printResult writes the giving task result as a status table row.
+func printResult(w io.Writer, tson string, res tasks.TaskResult) {
+	exitCode := "-"
+	if !res.Ended.IsZero() {
+		exitCode = fmt.Sprint(res.ExitCode)
+	}
+
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", tson, res.Name, res.Status, exitCode, res.Duration().Round(time.Millisecond))
+}
+
+func ctlRestart(ctx *cli.Context) error {
+	if !ctx.Args().Present() {
+		return errors.New("Expected name of Tson or task to restart")
+	}
+
+	res, err := controlCall(ctx, "POST", "restart", url.Values{"name": {ctx.Args().First()}})
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+func ctlTail(ctx *cli.Context) error {
+	query := url.Values{}
+	if ctx.Args().Present() {
+		query.Set("name", ctx.Args().First())
+	}
+
+	res, err := controlCall(ctx, "GET", "tail", query)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	_, err = io.Copy(os.Stdout, res.Body)
+	return err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestControlNetwork(t *testing.T) {
+	cases := []struct {
+		addr    string
+		network string
+		address string
+	}{
+		{"./taskr.sock", "unix", "./taskr.sock"},
+		{"/run/user/1000/taskr/ab12.sock", "unix", "/run/user/1000/taskr/ab12.sock"},
+		{"taskr.sock", "unix", "taskr.sock"},
+		{":7071", "tcp", "127.0.0.1:7071"},
+		{"tcp://:7071", "tcp", "127.0.0.1:7071"},
+		{"localhost:7071", "tcp", "localhost:7071"},
+		{"127.0.0.1:7071", "tcp", "127.0.0.1:7071"},
+		{"[::1]:7071", "tcp", "[::1]:7071"},
+	}
+
+	for _, c := range cases {
+		network, address, err := controlNetwork(c.addr)
+		if err != nil {
+			t.Fatalf("Should have accepted %q: %q", c.addr, err.Error())
+		}
+
+		if network != c.network || address != c.address {
+			t.Fatalf("Should have served %q on %s %q: %s %q", c.addr, c.network, c.address, network, address)
+		}
+	}
+
+	for _, addr := range []string{"0.0.0.0:7071", "tcp://192.168.1.4:7071", "example.com:7071", "[::]:7071"} {
+		if _, _, err := controlNetwork(addr); err == nil {
+			t.Fatalf("Should have refused non-loopback address %q", addr)
+		}
+	}
+}
+
+func TestLocalOnly(t *testing.T) {
+	handler := localOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		host   string
+		origin string
+		status int
+	}{
+		{"taskr", "", http.StatusNoContent},
+		{"localhost:7071", "", http.StatusNoContent},
+		{"127.0.0.1:7071", "", http.StatusNoContent},
+		{"[::1]:7071", "", http.StatusNoContent},
+		{"taskr", "http://evil.example", http.StatusForbidden},
+		{"127.0.0.1:7071", "http://127.0.0.1:7071", http.StatusForbidden},
+		{"evil.example:7071", "", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", "http://taskr/stop", nil)
+		req.Host = c.host
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.status {
+			t.Fatalf("Should have responded %d to host %q with origin %q: %d", c.status, c.host, c.origin, rec.Code)
+		}
+	}
+}
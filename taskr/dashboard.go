@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/influx6/clis/taskr/tasks"
+	fcontext "github.com/influx6/faux/context"
+	"github.com/influx6/fractals/fhttp"
+)
+
+// dashboardTokenHeader defines the header which carries the token for the
+// requests of the dashboard api.
+const dashboardTokenHeader = "X-Taskr-Token"
+
+// errDashboardToken is returned when a dashboard api request has a missing or
+// wrong token.
+var errDashboardToken = errors.New("Invalid or missing dashboard token")
+
+// errCrossOrigin is returned when a dashboard api request is sent by a page of
+// another site.
+var errCrossOrigin = errors.New("Cross-origin requests are not allowed")
+
+// serveDashboard serves the web dashboard of the series on the giving address,
+// returning a function to shut it down. A bare :port is served on 127.0.0.1.
+// Requests to its api must carry the giving token, else a random token which is
+// printed as part of the address of the dashboard.
+func serveDashboard(addr string, token string, series *tasks.TsonSeries) (func(), error) {
+	if token == "" {
+		var err error
+		if token, err = randomToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("tcp", localAddr(addr))
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: dashboardHandler(series, token)}
+	go server.Serve(listener)
+
+	fmt.Printf("Taskr dashboard available at http://%s/?token=%s\n", listener.Addr(), token)
+
+	return func() {
+		server.Close()
+	}, nil
+}
+
+// randomToken returns a random token for the dashboard.
+func randomToken() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
+
+// dashboardHandler returns the handler of the web dashboard of the series,
+// whose api requires the giving token.
+func dashboardHandler(series *tasks.TsonSeries, token string) http.Handler {
+	drive := fhttp.Drive()()
+	route := fhttp.Route(drive)
+
+	routeControl(drive, "/api", series)
+
+	route(fhttp.Endpoint{
+		Path:   "/",
+		Method: "GET",
+		Action: func(ctx fcontext.Context, rw *fhttp.Request) error {
+			rw.RespondAny(http.StatusOK, "text/html; charset=utf-8", []byte(dashboardPage))
+			return nil
+		},
+	})
+
+	route(fhttp.Endpoint{
+		Path:   "/api/events",
+		Method: "GET",
+		Action: func(ctx fcontext.Context, rw *fhttp.Request) error {
+			return streamEvents(rw, series)
+		},
+	})
+
+	return dashboardAuth(drive, token)
+}
+
+// dashboardAuth returns a handler which refuses api requests sent by pages of
+// other sites or without the giving token in the X-Taskr-Token header or the
+// token query parameter, leaving the page itself open as it holds no data.
+func dashboardAuth(handler http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+r.Host {
+			fhttp.RenderErrorWithStatus(http.StatusForbidden, errCrossOrigin, r, w)
+			return
+		}
+
+		given := r.Header.Get(dashboardTokenHeader)
+		if given == "" {
+			given = r.URL.Query().Get("token")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			fhttp.RenderErrorWithStatus(http.StatusUnauthorized, errDashboardToken, r, w)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// logEvent defines the payload of a log event sent to the dashboard.
+type logEvent struct {
+	Tson string `json:"tson"`
+	Text string `json:"text"`
+}
+
+// taskEvent defines the payload of a task or restart event sent to the
+// dashboard.
+type taskEvent struct {
+	Tson   string            `json:"tson"`
+	Task   string            `json:"task,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+	Result *tasks.TaskResult `json:"result,omitempty"`
+}
+
+// dashboardEvent defines a server-sent event of the giving name.
+type dashboardEvent struct {
+	name    string
+	payload interface{}
+}
+
+// eventBuffer sets the number of events a dashboard client may fall behind by
+// before further events are dropped for it.
+const eventBuffer = 64
+
+// eventObserver sends the events of the series a dashboard shows into events,
+// dropping those the client can not keep up with.
+type eventObserver struct {
+	tasks.NopObserver
+	events chan dashboardEvent
+}
+
+// send sends an event of the giving name and payload unless the client is
+// behind.
+func (eo eventObserver) send(name string, payload interface{}) {
+	select {
+	case eo.events <- dashboardEvent{name: name, payload: payload}:
+	default:
+	}
+}
+
+// Log implements the tasks.Observer interface.
+func (eo eventObserver) Log(tson string, text string) {
+	eo.send("log", logEvent{Tson: tson, Text: text})
+}
+
+// RestartBegan implements the tasks.Observer interface.
+func (eo eventObserver) RestartBegan(tson string, task string, reason string) {
+	eo.send("restart", taskEvent{Tson: tson, Task: task, Reason: reason})
+}
+
+// TaskStarted implements the tasks.Observer interface.
+func (eo eventObserver) TaskStarted(tson string, task string) {
+	eo.send("task", taskEvent{Tson: tson, Task: task})
+}
+
+// TaskExited implements the tasks.Observer interface.
+func (eo eventObserver) TaskExited(tson string, result tasks.TaskResult) {
+	eo.send("task", taskEvent{Tson: tson, Task: result.Name, Result: &result})
+}
+
+// streamEvents streams the output of all Tsons in the series along with the
+// restarts and runs of their tasks as server-sent events until the client
+// disconnects.
+func streamEvents(rw *fhttp.Request, series *tasks.TsonSeries) error {
+	observer := eventObserver{events: make(chan dashboardEvent, eventBuffer)}
+	defer series.Observe(observer)()
+
+	done := rw.Req.Context().Done()
+
+	rw.Res.Header().Set("Content-Type", "text/event-stream")
+	rw.Res.Header().Set("Cache-Control", "no-cache")
+	rw.Res.WriteHeader(http.StatusOK)
+	rw.Res.Flush()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case event := <-observer.events:
+			data, err := json.Marshal(event.payload)
+			if err != nil {
+				continue
+			}
+
+			if _, err := fmt.Fprintf(rw.Res, "event: %s\ndata: %s\n\n", event.name, data); err != nil {
+				return nil
+			}
+
+			rw.Res.Flush()
+		}
+	}
+}
+
+// dashboardPage defines the html page for the dashboard, which polls the
+// status api, refreshing it on task events, and listens for log events, passing
+// on the token from its address.
+const dashboardPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Taskr</title>
+<style>
+	body { font-family: sans-serif; margin: 2em; color: #222; }
+	h2 { margin-bottom: 0.2em; }
+	table { border-collapse: collapse; margin-bottom: 1em; }
+	td, th { padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; text-align: left; }
+	.running { color: #1565c0; } .done { color: #2e7d32; }
+	.failed, .timed-out { color: #c62828; } .stopped, .pending, .skipped { color: #757575; }
+	.history span { display: inline-block; width: 0.8em; height: 0.8em; margin-right: 2px; }
+	.history .done { background: #2e7d32; } .history .failed { background: #c62828; }
+	.history .stopped, .history .skipped { background: #9e9e9e; } .history .timed-out { background: #ef6c00; }
+	pre { background: #111; color: #ddd; padding: 1em; height: 20em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>Taskr</h1>
+<div>
+	<button onclick="command('pause')">Pause watching</button>
+	<button onclick="command('resume')">Resume watching</button>
+</div>
+<div id="tsons"></div>
+<h2>Logs</h2>
+<pre id="logs"></pre>
+<script>
+var token = new URLSearchParams(location.search).get('token') || '';
+
+function command(name, target) {
+	var url = '/api/' + name;
+	if (target) { url += '?name=' + encodeURIComponent(target); }
+	fetch(url, {method: 'POST', headers: {'X-Taskr-Token': token}}).then(refresh);
+}
+
+function esc(value) {
+	return String(value).replace(/[&<>"']/g, function(c) {
+		return '&#' + c.charCodeAt(0) + ';';
+	});
+}
+
+function statusClass(status) {
+	return String(status).replace(/ /g, '-');
+}
+
+function row(res) {
+	var exit = res.ended && res.ended.indexOf('0001') !== 0 ? res.exit_code : '-';
+	return '<tr><td>' + esc(res.name) + '</td><td class="' + statusClass(res.status) + '">' + esc(res.status) +
+		'</td><td>' + exit + '</td><td>' + esc(res.error || '') + '</td></tr>';
+}
+
+function render(status) {
+	var html = '';
+	(status || []).forEach(function(tson) {
+		html += '<h2>' + esc(tson.name) + (tson.paused ? ' (paused)' : '') +
+			' <button data-name="' + esc(tson.name) + '">Restart</button></h2>';
+		(tson.matrices || []).forEach(function(matrix) {
+			var counts = Object.keys(matrix.counts).sort().map(function(status) {
+				return matrix.counts[status] + ' ' + esc(status);
+			}).join(', ');
+			html += '<p>Matrix ' + esc(matrix.name) + ': ' + matrix.total + ' tasks: ' + counts + '</p>';
+		});
+		(tson.tasks || []).forEach(function(mt) {
+			var history = (mt.history || []).map(function(res) {
+				return '<span class="' + statusClass(res.status) + '" title="exit ' + res.exit_code + '"></span>';
+			}).join('');
+			html += '<h3>' + esc(mt.name) + ' <button data-name="' + esc(mt.name) + '">Restart</button>' +
+				' <span class="history">' + history + '</span></h3><table>' +
+				'<tr><th>Task</th><th>Status</th><th>Exit</th><th>Error</th></tr>';
+			(mt.before || []).forEach(function(res) { html += row(res); });
+			html += row(mt.main);
+			(mt.after || []).forEach(function(res) { html += row(res); });
+			html += '</table>';
+		});
+	});
+	document.getElementById('tsons').innerHTML = html;
+}
+
+function refresh() {
+	fetch('/api/status', {headers: {'X-Taskr-Token': token}}).then(function(res) { return res.json(); }).then(render);
+}
+
+document.getElementById('tsons').addEventListener('click', function(ev) {
+	var name = ev.target.getAttribute('data-name');
+	if (name) { command('restart', name); }
+});
+
+var logs = document.getElementById('logs');
+var events = new EventSource('/api/events?token=' + encodeURIComponent(token));
+events.addEventListener('log', function(ev) {
+	var event = JSON.parse(ev.data);
+	logs.appendChild(document.createTextNode('[' + event.tson + '] ' + event.text));
+	logs.scrollTop = logs.scrollHeight;
+});
+events.addEventListener('task', refresh);
+events.addEventListener('restart', refresh);
+
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+// startSeries starts a series with a web Tson whose server task runs until
+// stopped, stopping it when the test ends.
+func startSeries(t *testing.T) *tasks.TsonSeries {
+	series := tasks.New(&tasks.Tson{
+		Name:       "web",
+		Sink:       ioutil.Discard,
+		WriteDelay: "10ms",
+		Tasks: []*tasks.MasterTask{
+			{
+				Main: &tasks.Task{Name: "server", Command: "sleep", Parameters: []string{"30"}},
+			},
+		},
+	})
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	t.Cleanup(func() {
+		series.Stop()
+		series.Wait()
+	})
+
+	return series
+}
+
+// dashboardRequest sends a request to the handler with the giving token in
+// the X-Taskr-Token header, returning the response.
+func dashboardRequest(handler http.Handler, method string, target string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set(dashboardTokenHeader, token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestDashboardAuth(t *testing.T) {
+	handler := dashboardHandler(startSeries(t), "s3cr3t")
+
+	if rec := dashboardRequest(handler, "GET", "/", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Should have served page without token: %d", rec.Code)
+	}
+
+	if rec := dashboardRequest(handler, "GET", "/api/status", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Should have refused request without token: %d", rec.Code)
+	}
+
+	if rec := dashboardRequest(handler, "POST", "/api/pause", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Should have refused request with wrong token: %d", rec.Code)
+	}
+
+	if rec := dashboardRequest(handler, "GET", "/api/status", "s3cr3t"); rec.Code != http.StatusOK {
+		t.Fatalf("Should have accepted token in header: %d", rec.Code)
+	}
+
+	if rec := dashboardRequest(handler, "GET", "/api/status?token=s3cr3t", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Should have accepted token in query: %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/api/stop", nil)
+	req.Host = "127.0.0.1:7070"
+	req.Header.Set(dashboardTokenHeader, "s3cr3t")
+	req.Header.Set("Origin", "http://evil.example")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Should have refused cross-origin request: %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/pause", nil)
+	req.Host = "127.0.0.1:7070"
+	req.Header.Set(dashboardTokenHeader, "s3cr3t")
+	req.Header.Set("Origin", "http://127.0.0.1:7070")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Should have accepted same-origin request: %d", rec.Code)
+	}
+
+	if addr := localAddr(":7070"); addr != "127.0.0.1:7070" {
+		t.Fatalf("Should have served bare port on localhost: %q", addr)
+	}
+}
+
+func TestDashboardRoutes(t *testing.T) {
+	series := startSeries(t)
+	handler := dashboardHandler(series, "s3cr3t")
+
+	rec := dashboardRequest(handler, "GET", "/api/status", "s3cr3t")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Should have served status: %d", rec.Code)
+	}
+
+	var status []tasks.TsonStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Should have decoded status: %q", err.Error())
+	}
+
+	if len(status) != 1 || status[0].Name != "web" || status[0].Tasks[0].Main.Name != "server" {
+		t.Fatalf("Should have status of web tson: %+v", status)
+	}
+
+	if rec := dashboardRequest(handler, "GET", "/api/pause", "s3cr3t"); rec.Code == http.StatusNoContent {
+		t.Fatal("Should have refused pause through GET")
+	}
+
+	if rec := dashboardRequest(handler, "POST", "/api/pause", "s3cr3t"); rec.Code != http.StatusNoContent {
+		t.Fatalf("Should have paused series: %d", rec.Code)
+	}
+
+	if !series.Status()[0].Paused {
+		t.Fatal("Should have paused web tson")
+	}
+
+	if rec := dashboardRequest(handler, "POST", "/api/resume", "s3cr3t"); rec.Code != http.StatusNoContent {
+		t.Fatalf("Should have resumed series: %d", rec.Code)
+	}
+
+	if series.Status()[0].Paused {
+		t.Fatal("Should have resumed web tson")
+	}
+
+	if rec := dashboardRequest(handler, "POST", "/api/restart?name=server", "s3cr3t"); rec.Code != http.StatusNoContent {
+		t.Fatalf("Should have restarted task: %d", rec.Code)
+	}
+
+	if rec := dashboardRequest(handler, "POST", "/api/restart?name=missing", "s3cr3t"); rec.Code != http.StatusNotFound {
+		t.Fatalf("Should have failed to find missing task: %d", rec.Code)
+	}
+
+	if rec := dashboardRequest(handler, "POST", "/api/stop", "s3cr3t"); rec.Code != http.StatusNoContent {
+		t.Fatalf("Should have stopped series: %d", rec.Code)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		series.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Should have stopped series")
+	}
+}
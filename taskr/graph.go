@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/influx6/clis/taskr/tasks"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// graphNode defines a node of the task graph.
+type graphNode struct {
+	id      string
+	label   string
+	trigger bool
+}
+
+// graphEdge defines an edge of the task graph, which is dashed for edges from
+// triggers.
+type graphEdge struct {
+	from   string
+	to     string
+	dashed bool
+}
+
+// graphCluster defines a group of nodes of the task graph, which may hold
+// nested groups.
+type graphCluster struct {
+	id       string
+	label    string
+	nodes    []graphNode
+	clusters []*graphCluster
+}
+
+// taskGraph defines the graph of all Tsons, with a cluster for each.
+type taskGraph struct {
+	clusters []*graphCluster
+	edges    []graphEdge
+}
+
+// newTaskGraph returns the graph of the giving plans, where each Tson is a
+// cluster holding its triggers and a cluster for each master task, whose tasks
+// are chained in the order they run, followed by its teardown tasks triggered
+// by its stop.
+func newTaskGraph(plans []tasks.TsonPlan) *taskGraph {
+	var graph taskGraph
+
+	for ti, tson := range plans {
+		cluster := &graphCluster{id: fmt.Sprintf("t%d", ti), label: tson.Name}
+		graph.clusters = append(graph.clusters, cluster)
+
+		var triggers []string
+
+		addTrigger := func(label string) {
+			id := fmt.Sprintf("t%d_trigger%d", ti, len(triggers))
+			cluster.nodes = append(cluster.nodes, graphNode{id: id, label: label, trigger: true})
+			triggers = append(triggers, id)
+		}
+
+		if tson.Schedule != "" {
+			addTrigger("schedule " + tson.Schedule)
+		} else {
+			addTrigger("start")
+		}
+
+		for _, glob := range tson.Globs {
+			addTrigger("watch " + glob)
+		}
+
+		for mi, mt := range tson.Tasks {
+			label := mt.Name
+			if mt.Matrix != "" {
+				label = "matrix: " + label
+			}
+
+			mcluster := &graphCluster{id: fmt.Sprintf("t%d_m%d", ti, mi), label: label}
+			cluster.clusters = append(cluster.clusters, mcluster)
+
+			var last string
+
+			for _, tk := range mt.Tasks {
+				id := fmt.Sprintf("t%d_m%d_s%d", ti, mi, tk.Step)
+				mcluster.nodes = append(mcluster.nodes, graphNode{
+					id:    id,
+					label: fmt.Sprintf("%s: %s\n%s", tk.Stage, tk.Name, tk.CommandLine),
+				})
+
+				if last == "" {
+					for _, trigger := range triggers {
+						graph.edges = append(graph.edges, graphEdge{from: trigger, to: id, dashed: true})
+					}
+				} else {
+					graph.edges = append(graph.edges, graphEdge{from: last, to: id})
+				}
+
+				last = id
+			}
+		}
+
+		if len(tson.Teardown) == 0 {
+			continue
+		}
+
+		stop := fmt.Sprintf("t%d_stop", ti)
+		cluster.nodes = append(cluster.nodes, graphNode{id: stop, label: "stop", trigger: true})
+
+		tcluster := &graphCluster{id: fmt.Sprintf("t%d_teardown", ti), label: tasks.StageTeardown}
+		cluster.clusters = append(cluster.clusters, tcluster)
+
+		last := stop
+		for _, tk := range tson.Teardown {
+			id := fmt.Sprintf("t%d_teardown_s%d", ti, tk.Step)
+			tcluster.nodes = append(tcluster.nodes, graphNode{
+				id:    id,
+				label: fmt.Sprintf("%s: %s\n%s", tk.Stage, tk.Name, tk.CommandLine),
+			})
+
+			graph.edges = append(graph.edges, graphEdge{from: last, to: id, dashed: last == stop})
+			last = id
+		}
+	}
+
+	return &graph
+}
+
+// writeDOT writes the graph in the Graphviz DOT format.
+func (g *taskGraph) writeDOT(w io.Writer) {
+	fmt.Fprintln(w, "digraph taskr {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+
+	var writeCluster func(cluster *graphCluster, indent string)
+	writeCluster = func(cluster *graphCluster, indent string) {
+		fmt.Fprintf(w, "%ssubgraph cluster_%s {\n", indent, cluster.id)
+		fmt.Fprintf(w, "%s  label=%s;\n", indent, dotQuote(cluster.label))
+
+		for _, node := range cluster.nodes {
+			shape := ""
+			if node.trigger {
+				shape = ", shape=ellipse"
+			}
+
+			fmt.Fprintf(w, "%s  %s [label=%s%s];\n", indent, node.id, dotQuote(node.label), shape)
+		}
+
+		for _, nested := range cluster.clusters {
+			writeCluster(nested, indent+"  ")
+		}
+
+		fmt.Fprintf(w, "%s}\n", indent)
+	}
+
+	for _, cluster := range g.clusters {
+		writeCluster(cluster, "  ")
+	}
+
+	for _, edge := range g.edges {
+		style := ""
+		if edge.dashed {
+			style = " [style=dashed]"
+		}
+
+		fmt.Fprintf(w, "  %s -> %s%s;\n", edge.from, edge.to, style)
+	}
+
+	fmt.Fprintln(w, "}")
+}
+
+// writeMermaid writes the graph as a Mermaid flowchart.
+func (g *taskGraph) writeMermaid(w io.Writer) {
+	fmt.Fprintln(w, "flowchart LR")
+
+	var writeCluster func(cluster *graphCluster, indent string)
+	writeCluster = func(cluster *graphCluster, indent string) {
+		fmt.Fprintf(w, "%ssubgraph %s[%s]\n", indent, cluster.id, mermaidQuote(cluster.label))
+
+		for _, node := range cluster.nodes {
+			if node.trigger {
+				fmt.Fprintf(w, "%s  %s([%s])\n", indent, node.id, mermaidQuote(node.label))
+				continue
+			}
+
+			fmt.Fprintf(w, "%s  %s[%s]\n", indent, node.id, mermaidQuote(node.label))
+		}
+
+		for _, nested := range cluster.clusters {
+			writeCluster(nested, indent+"  ")
+		}
+
+		fmt.Fprintf(w, "%send\n", indent)
+	}
+
+	for _, cluster := range g.clusters {
+		writeCluster(cluster, "  ")
+	}
+
+	for _, edge := range g.edges {
+		arrow := "-->"
+		if edge.dashed {
+			arrow = "-.->"
+		}
+
+		fmt.Fprintf(w, "  %s %s %s\n", edge.from, arrow, edge.to)
+	}
+}
+
+// dotQuote returns the giving label as a quoted DOT string.
+func dotQuote(label string) string {
+	label = strings.ReplaceAll(label, `\`, `\\`)
+	label = strings.ReplaceAll(label, `"`, `\"`)
+	label = strings.ReplaceAll(label, "\n", `\n`)
+
+	return `"` + label + `"`
+}
+
+// mermaidQuote returns the giving label as a quoted Mermaid string, escaping
+// the characters Mermaid reads as entity codes or html.
+func mermaidQuote(label string) string {
+	label = strings.ReplaceAll(label, "#", "#35;")
+	label = strings.ReplaceAll(label, `"`, "#quot;")
+	label = strings.ReplaceAll(label, "<", "#lt;")
+	label = strings.ReplaceAll(label, ">", "#gt;")
+	label = strings.ReplaceAll(label, "\n", "<br/>")
+
+	return `"` + label + `"`
+}
+
+// graphTasks prints the graph of the tasks file in the format set by the
+// format flag.
+func graphTasks(ctx *cli.Context) error {
+	series, err := loadSeries(ctx)
+	if err != nil {
+		return err
+	}
+
+	plans, err := series.Plan()
+	if err != nil {
+		return err
+	}
+
+	graph := newTaskGraph(plans)
+
+	switch format := ctx.String("format"); format {
+	case "", "dot":
+		graph.writeDOT(os.Stdout)
+	case "mermaid":
+		graph.writeMermaid(os.Stdout)
+	default:
+		return fmt.Errorf("Unknown graph format %q, expected dot or mermaid", format)
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+// graphPlans returns the plans of a watched web Tson with a teardown and a
+// scheduled Tson with a matrix, whose names hold quotes, brackets and newlines.
+func graphPlans() []tasks.TsonPlan {
+	return []tasks.TsonPlan{
+		{
+			Name:  "web",
+			Globs: []string{"*.go"},
+			Tasks: []tasks.MasterTaskPlan{
+				{
+					Name: "server",
+					Tasks: []tasks.TaskPlan{
+						{Step: 1, Stage: tasks.StageBefore, Name: "build", CommandLine: `go build -o "bin/app"`},
+						{Step: 2, Stage: tasks.StageMain, Name: "server", CommandLine: "bin/app"},
+					},
+				},
+			},
+			Teardown: []tasks.TaskPlan{
+				{Step: 1, Stage: tasks.StageTeardown, Name: "clean", CommandLine: "rm -rf bin"},
+			},
+		},
+		{
+			Name:     `say "hi" [x]`,
+			Schedule: "@every 1m",
+			Tasks: []tasks.MasterTaskPlan{
+				{
+					Name:   "test",
+					Matrix: "go=1.20",
+					Tasks: []tasks.TaskPlan{
+						{Step: 1, Stage: tasks.StageMain, Name: "test\n#1 <a>", CommandLine: `echo C:\tmp`},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestGraphDOT(t *testing.T) {
+	var out bytes.Buffer
+	newTaskGraph(graphPlans()).writeDOT(&out)
+
+	expected := `digraph taskr {
+  rankdir=LR;
+  node [shape=box];
+  subgraph cluster_t0 {
+    label="web";
+    t0_trigger0 [label="start", shape=ellipse];
+    t0_trigger1 [label="watch *.go", shape=ellipse];
+    t0_stop [label="stop", shape=ellipse];
+    subgraph cluster_t0_m0 {
+      label="server";
+      t0_m0_s1 [label="before: build\ngo build -o \"bin/app\""];
+      t0_m0_s2 [label="main: server\nbin/app"];
+    }
+    subgraph cluster_t0_teardown {
+      label="teardown";
+      t0_teardown_s1 [label="teardown: clean\nrm -rf bin"];
+    }
+  }
+  subgraph cluster_t1 {
+    label="say \"hi\" [x]";
+    t1_trigger0 [label="schedule @every 1m", shape=ellipse];
+    subgraph cluster_t1_m0 {
+      label="matrix: test";
+      t1_m0_s1 [label="main: test\n#1 <a>\necho C:\\tmp"];
+    }
+  }
+  t0_trigger0 -> t0_m0_s1 [style=dashed];
+  t0_trigger1 -> t0_m0_s1 [style=dashed];
+  t0_m0_s1 -> t0_m0_s2;
+  t0_stop -> t0_teardown_s1 [style=dashed];
+  t1_trigger0 -> t1_m0_s1 [style=dashed];
+}
+`
+
+	if out.String() != expected {
+		t.Fatalf("Should have written DOT graph:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestGraphMermaid(t *testing.T) {
+	var out bytes.Buffer
+	newTaskGraph(graphPlans()).writeMermaid(&out)
+
+	expected := `flowchart LR
+  subgraph t0["web"]
+    t0_trigger0(["start"])
+    t0_trigger1(["watch *.go"])
+    t0_stop(["stop"])
+    subgraph t0_m0["server"]
+      t0_m0_s1["before: build<br/>go build -o #quot;bin/app#quot;"]
+      t0_m0_s2["main: server<br/>bin/app"]
+    end
+    subgraph t0_teardown["teardown"]
+      t0_teardown_s1["teardown: clean<br/>rm -rf bin"]
+    end
+  end
+  subgraph t1["say #quot;hi#quot; [x]"]
+    t1_trigger0(["schedule @every 1m"])
+    subgraph t1_m0["matrix: test"]
+      t1_m0_s1["main: test<br/>#35;1 #lt;a#gt;<br/>echo C:\tmp"]
+    end
+  end
+  t0_trigger0 -.-> t0_m0_s1
+  t0_trigger1 -.-> t0_m0_s1
+  t0_m0_s1 --> t0_m0_s2
+  t0_stop -.-> t0_teardown_s1
+  t1_trigger0 -.-> t1_m0_s1
+`
+
+	if out.String() != expected {
+		t.Fatalf("Should have written Mermaid graph:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestGraphQuote(t *testing.T) {
+	cases := []struct {
+		label   string
+		dot     string
+		mermaid string
+	}{
+		{"plain", `"plain"`, `"plain"`},
+		{`say "hi"`, `"say \"hi\""`, `"say #quot;hi#quot;"`},
+		{"[x] (y) {z}", `"[x] (y) {z}"`, `"[x] (y) {z}"`},
+		{"two\nlines", `"two\nlines"`, `"two<br/>lines"`},
+		{`C:\tmp`, `"C:\\tmp"`, `"C:\tmp"`},
+		{"#quot; <b>", `"#quot; <b>"`, `"#35;quot; #lt;b#gt;"`},
+	}
+
+	for _, c := range cases {
+		if quoted := dotQuote(c.label); quoted != c.dot {
+			t.Fatalf("Should have quoted %q for DOT as %s: %s", c.label, c.dot, quoted)
+		}
+
+		if quoted := mermaidQuote(c.label); quoted != c.mermaid {
+			t.Fatalf("Should have quoted %q for Mermaid as %s: %s", c.label, c.mermaid, quoted)
+		}
+
+		if strings.Contains(dotQuote(c.label), "\n") || strings.Contains(mermaidQuote(c.label), "\n") {
+			t.Fatalf("Should have kept quoted %q on one line", c.label)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/influx6/clis/taskr/tasks"
+	fcontext "github.com/influx6/faux/context"
+	"github.com/influx6/fractals/fhttp"
+)
+
+// hookSecretHeader defines the header which carries the shared secret for
+// trigger requests.
+const hookSecretHeader = "X-Taskr-Secret"
+
+// errHookSecret is returned when a trigger request has a missing or wrong secret.
+var errHookSecret = errors.New("Invalid or missing trigger secret")
+
+// serveHook serves the trigger endpoint of the series on the giving address,
+// returning a function to shut it down. If secret is not empty, requests must
+// carry it in the X-Taskr-Secret header or the secret query parameter.
+func serveHook(addr string, secret string, series *tasks.TsonSeries) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: hookHandler(series, secret)}
+	go server.Serve(listener)
+
+	fmt.Printf("Taskr triggers available at http://%s/trigger/<name>\n", listener.Addr())
+
+	return func() {
+		server.Close()
+	}, nil
+}
+
+// hookHandler returns the handler of the trigger endpoint of the series, which
+// requires the giving secret if not empty.
+func hookHandler(series *tasks.TsonSeries, secret string) http.Handler {
+	drive := fhttp.Drive()()
+	route := fhttp.Route(drive)
+
+	route(fhttp.Endpoint{
+		Path:   "/trigger/:name",
+		Method: "POST",
+		Action: func(ctx fcontext.Context, rw *fhttp.Request) error {
+			if !validHookSecret(rw.Req, secret) {
+				rw.RespondError(http.StatusUnauthorized, errHookSecret)
+				return nil
+			}
+
+			name := rw.Params["name"]
+			if err := series.Restart(name); err != nil {
+				rw.RespondError(http.StatusNotFound, err)
+				return nil
+			}
+
+			rw.Respond(http.StatusAccepted, map[string]string{"triggered": name})
+			return nil
+		},
+	})
+
+	return drive
+}
+
+// validHookSecret returns true/false if the request carries the giving secret,
+// always returning true if the secret is empty.
+func validHookSecret(req *http.Request, secret string) bool {
+	if secret == "" {
+		return true
+	}
+
+	given := req.Header.Get(hookSecretHeader)
+	if given == "" {
+		given = req.URL.Query().Get("secret")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidHookSecret(t *testing.T) {
+	cases := []struct {
+		target string
+		header string
+		secret string
+		valid  bool
+	}{
+		{"/trigger/web", "", "", true},
+		{"/trigger/web?secret=anything", "", "", true},
+		{"/trigger/web", "s3cr3t", "s3cr3t", true},
+		{"/trigger/web?secret=s3cr3t", "", "s3cr3t", true},
+		{"/trigger/web?secret=s3cr3t", "wrong", "s3cr3t", false},
+		{"/trigger/web?secret=wrong", "", "s3cr3t", false},
+		{"/trigger/web", "s3cr3", "s3cr3t", false},
+		{"/trigger/web", "", "s3cr3t", false},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", c.target, nil)
+		if c.header != "" {
+			req.Header.Set(hookSecretHeader, c.header)
+		}
+
+		if valid := validHookSecret(req, c.secret); valid != c.valid {
+			t.Fatalf("Should have found secret of %q with header %q valid=%t for %q", c.target, c.header, c.valid, c.secret)
+		}
+	}
+}
+
+func TestHookHandler(t *testing.T) {
+	series := startSeries(t)
+
+	trigger := func(handler http.Handler, method string, target string, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if secret != "" {
+			req.Header.Set(hookSecretHeader, secret)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	handler := hookHandler(series, "s3cr3t")
+
+	rec := trigger(handler, "POST", "/trigger/server", "s3cr3t")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Should have triggered task with header secret: %d", rec.Code)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["triggered"] != "server" {
+		t.Fatalf("Should have named triggered task: %s", rec.Body.String())
+	}
+
+	if rec := trigger(handler, "POST", "/trigger/web?secret=s3cr3t", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("Should have triggered tson with query secret: %d", rec.Code)
+	}
+
+	if rec := trigger(handler, "POST", "/trigger/server", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Should have refused wrong secret: %d", rec.Code)
+	}
+
+	if rec := trigger(handler, "POST", "/trigger/server", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Should have refused missing secret: %d", rec.Code)
+	}
+
+	if rec := trigger(handler, "POST", "/trigger/missing", "s3cr3t"); rec.Code != http.StatusNotFound {
+		t.Fatalf("Should have failed to find missing task: %d", rec.Code)
+	}
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		if rec := trigger(handler, method, "/trigger/server", "s3cr3t"); rec.Code == http.StatusAccepted {
+			t.Fatalf("Should have refused %s request: %d", method, rec.Code)
+		}
+	}
+
+	open := hookHandler(series, "")
+
+	if rec := trigger(open, "POST", "/trigger/server", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("Should have triggered task without secret configured: %d", rec.Code)
+	}
+
+	if rec := trigger(open, "POST", "/trigger/missing", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("Should have failed to find missing task without secret configured: %d", rec.Code)
+	}
+}
@@ -2,11 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"strings"
+	"time"
 
 	"github.com/influx6/clis/taskr/tasks"
 
@@ -22,6 +23,11 @@ var (
 	- Create a 'tasks.json' file easily
 
 		> taskr init
+		> taskr init --template go-web --force
+
+	- Create a 'tasks.json' file from the commands of a Procfile, package.json or Makefile
+
+		> taskr init --from package.json
 
 	- Run all defined tasks
 
@@ -31,25 +37,44 @@ var (
 	- Run tasks in a specificed task file
 
 		> taskr run --in ./bonds/task.json
-`
 
-	template = `[{
-  "desc": "Example description",
-  "write_delay": "20ms",
-	"debounce_delay": "5s",
-  "tasks": [{
-    "max_runtime": "1m",
-    "max_checktime": "500ms",
-    "main": {
-      "name": "Sample",
-      "command":"echo",
-      "params": ["Sample"],
-      "desc": "Sample main task"
-    },
-    "before":[],
-    "after":[]
-  }]
-}]
+	- Run the processes of a Procfile
+
+		> taskr run --procfile Procfile
+
+	- Run tasks with a web dashboard
+
+		> taskr run --ui :7070
+
+	- Run tasks which can be restarted through http, e.g from a git hook
+
+		> taskr run --hook localhost:7072 --hook-secret secret
+		> curl -X POST -H 'X-Taskr-Secret: secret' localhost:7072/trigger/<name>
+
+	- See what would be run without running anything
+
+		> taskr run --dry-run
+		> taskr run --plan json
+
+	- Write the results of a run for a CI server, with a summary table printed
+	  when no Tson watches files or runs on a schedule
+
+		> taskr run --junit report.xml --report report.json
+
+	- Draw the tasks file as a graph
+
+		> taskr graph | dot -Tsvg > tasks.svg
+		> taskr graph --format mermaid
+
+	- Show how long tasks take and how much memory they use across runs
+
+		> taskr stats
+		> taskr stats --task Build --last 20
+
+	- Check on or restart tasks of a running taskr
+
+		> taskr ctl status
+		> taskr ctl restart <name>
 `
 )
 
@@ -64,7 +89,22 @@ func main() {
 			Name:        "init",
 			Usage:       "taskr init",
 			Description: "Generates a initial tasks.json file for customizer",
-			Action:      initJSON,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "from",
+					Usage: "from=Procfile|package.json|Makefile generates the tasks from the commands of the giving file",
+				},
+				&cli.StringFlag{
+					Name:        "template",
+					Usage:       "template=go-web|gopherjs|node|static-site generates the tasks from the giving template",
+					DefaultText: "detected from go.mod or package.json",
+				},
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "Overwrites an existing tasks.json",
+				},
+			},
+			Action: initJSON,
 		},
 		{
 			Name:        "run",
@@ -75,11 +115,187 @@ func main() {
 					Name:        "in",
 					Aliases:     []string{"input"},
 					Usage:       "in=tasks.json",
-					DefaultText: "tasks.json",
+					DefaultText: "nearest tasks.json in the current directory or its parents",
+				},
+				&cli.StringFlag{
+					Name:        "control",
+					Usage:       "control=./taskr.sock or control=127.0.0.1:7071, tcp only on loopback addresses",
+					DefaultText: "socket of the project in the user runtime or cache directory",
+				},
+				&cli.BoolFlag{
+					Name:  "no-global",
+					Usage: "Leaves out the Tsons of the global tasks file",
+				},
+				&cli.BoolFlag{
+					Name:  "no-reload",
+					Usage: "Disables reloading the tasks when the tasks file changes",
+				},
+				&cli.BoolFlag{
+					Name:  "no-control",
+					Usage: "Disables the control endpoint used by taskr ctl",
+				},
+				&cli.IntFlag{
+					Name:  "jobs",
+					Usage: "jobs=4 limits the number of master tasks running at once, leaving out services, unlimited if 0",
+				},
+				&cli.StringFlag{
+					Name:  "ui",
+					Usage: "ui=:7070 serves a web dashboard on the giving address, with a bare :port on 127.0.0.1",
+				},
+				&cli.StringFlag{
+					Name:        "ui-token",
+					Usage:       "ui-token=token requires dashboard api requests to carry the token",
+					EnvVars:     []string{"TASKR_UI_TOKEN"},
+					DefaultText: "random token printed with the dashboard address",
+				},
+				&cli.StringFlag{
+					Name:  "hook",
+					Usage: "hook=localhost:7072 serves POST /trigger/<name> to restart a Tson or task",
+				},
+				&cli.StringFlag{
+					Name:    "hook-secret",
+					Usage:   "hook-secret=secret requires trigger requests to carry the secret",
+					EnvVars: []string{"TASKR_HOOK_SECRET"},
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Prints the plan of what would be run without running anything",
+				},
+				&cli.StringFlag{
+					Name:  "plan",
+					Usage: "plan=text|json prints the plan in the giving format without running anything",
+				},
+				&cli.StringFlag{
+					Name:  "procfile",
+					Usage: "procfile=Procfile runs the processes of the giving Procfile instead of a tasks file",
+				},
+				&cli.StringFlag{
+					Name:  "junit",
+					Usage: "junit=report.xml writes the results of the tasks as a JUnit XML report on exit",
+				},
+				&cli.StringFlag{
+					Name:  "report",
+					Usage: "report=report.json writes the results of the tasks as a JSON report on exit",
+				},
+				&cli.StringFlag{
+					Name:        "stats",
+					Usage:       "stats=./stats.jsonl records the time and memory used by each task run",
+					DefaultText: "a file for the tasks file in the user cache directory",
+				},
+				&cli.BoolFlag{
+					Name:  "no-stats",
+					Usage: "Disables recording the time and memory used by each task run",
 				},
 			},
 			Action: taskRunner,
 		},
+		{
+			Name:        "stats",
+			Usage:       "taskr stats [--task name]",
+			Description: "Prints the time and memory used by tasks across their recorded runs, with the trend of their time",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "in",
+					Aliases:     []string{"input"},
+					Usage:       "in=tasks.json",
+					DefaultText: "nearest tasks.json in the current directory or its parents",
+				},
+				&cli.StringFlag{
+					Name:        "stats",
+					Usage:       "stats=./stats.jsonl",
+					DefaultText: "a file for the tasks file in the user cache directory",
+				},
+				&cli.StringFlag{
+					Name:  "task",
+					Usage: "task=Build lists the runs of the task or Tson with the giving name",
+				},
+				&cli.IntFlag{
+					Name:  "last",
+					Usage: "last=20 limits the runs listed by --task to the latest ones",
+					Value: 20,
+				},
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "Prints the stats as json",
+				},
+			},
+			Action: showStats,
+		},
+		{
+			Name:        "graph",
+			Usage:       "taskr graph --format dot|mermaid",
+			Description: "Prints the graph of the Tsons, their triggers and tasks in the tasks file",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "in",
+					Aliases:     []string{"input"},
+					Usage:       "in=tasks.json",
+					DefaultText: "nearest tasks.json in the current directory or its parents",
+				},
+				&cli.StringFlag{
+					Name:        "format",
+					Usage:       "format=dot|mermaid",
+					DefaultText: "dot",
+				},
+				&cli.BoolFlag{
+					Name:  "no-global",
+					Usage: "Leaves out the Tsons of the global tasks file",
+				},
+			},
+			Action: graphTasks,
+		},
+		{
+			Name:        "ctl",
+			Usage:       "taskr ctl status|restart <name>|stop|pause|resume|tail [name]",
+			Description: "Sends commands to a running taskr through its control endpoint",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "in",
+					Aliases:     []string{"input"},
+					Usage:       "in=tasks.json",
+					DefaultText: "nearest tasks.json in the current directory or its parents",
+				},
+				&cli.StringFlag{
+					Name:        "control",
+					Usage:       "control=./taskr.sock or control=127.0.0.1:7071, tcp only on loopback addresses",
+					DefaultText: "socket of the project in the user runtime or cache directory",
+				},
+			},
+			Subcommands: []*cli.Command{
+				{
+					Name:   "status",
+					Usage:  "Lists the status of all tasks",
+					Action: ctlStatus,
+				},
+				{
+					Name:      "restart",
+					Usage:     "Restarts the Tson or task with the giving name",
+					ArgsUsage: "<name>",
+					Action:    ctlRestart,
+				},
+				{
+					Name:   "stop",
+					Usage:  "Stops all tasks and ends the running taskr",
+					Action: controlCommand("stop"),
+				},
+				{
+					Name:   "pause",
+					Usage:  "Stops restarting tasks on file changes",
+					Action: controlCommand("pause"),
+				},
+				{
+					Name:   "resume",
+					Usage:  "Resumes restarting tasks on file changes",
+					Action: controlCommand("resume"),
+				},
+				{
+					Name:      "tail",
+					Usage:     "Streams the output of all Tsons or the Tson with the giving name",
+					ArgsUsage: "[name]",
+					Action:    ctlTail,
+				},
+			},
+		},
 	}
 
 	app.Run(os.Args)
@@ -93,7 +309,40 @@ func initJSON(ctx *cli.Context) error {
 
 	newFile := filepath.Join(cdir, "tasks.json")
 
-	if err := ioutil.WriteFile(newFile, []byte(template), 0777); err != nil {
+	if _, err := os.Stat(newFile); err == nil && !ctx.Bool("force") {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", newFile)
+	}
+
+	if ctx.String("from") != "" && ctx.String("template") != "" {
+		return errors.New("--from and --template can not be used together")
+	}
+
+	var data []byte
+
+	if from := ctx.String("from"); from != "" {
+		tson, err := tasks.Import(from)
+		if err != nil {
+			return err
+		}
+
+		if data, err = json.MarshalIndent([]*tasks.Tson{tson}, "", "  "); err != nil {
+			return err
+		}
+
+		data = append(data, '\n')
+	} else {
+		name := ctx.String("template")
+		if name == "" {
+			name = detectTemplate(cdir)
+			fmt.Printf("Using %q template\n", name)
+		}
+
+		if data, err = loadTemplate(name); err != nil {
+			return err
+		}
+	}
+
+	if err := ioutil.WriteFile(newFile, data, 0644); err != nil {
 		return err
 	}
 
@@ -101,47 +350,83 @@ func initJSON(ctx *cli.Context) error {
 }
 
 func taskRunner(ctx *cli.Context) error {
-	cdir, err := os.Getwd()
+	tseries, err := loadSeries(ctx)
 	if err != nil {
 		return err
 	}
 
-	userFile := ctx.String("input")
+	tseries.Jobs = ctx.Int("jobs")
 
-	if userFile != "" {
-		if strings.HasPrefix(userFile, ".") || !strings.HasPrefix(userFile, "/") {
-			userFile = filepath.Join(cdir, userFile)
-		}
-	} else {
-		userFile = filepath.Join(cdir, "tasks.json")
+	if ctx.Bool("dry-run") || ctx.IsSet("plan") {
+		return printPlan(tseries, ctx.String("plan"))
 	}
 
-	data, err := ioutil.ReadFile(userFile)
-	if err != nil {
+	tseries.Stats = openStats(ctx)
+
+	started := time.Now()
+
+	if err := tseries.Start(); err != nil {
 		return err
 	}
 
-	var taskCol []*tasks.Tson
-
-	if err := json.Unmarshal(data, &taskCol); err != nil {
+	// abort stops the started tasks before giving up on the run with the
+	// giving error, so none are left running.
+	abort := func(err error) error {
+		tseries.Stop()
+		tseries.Wait()
 		return err
 	}
 
-	tseries := tasks.New(taskCol...)
+	var reload func()
 
-	if err := tseries.Start(); err != nil {
-		return err
+	if !tseries.OneShot() && ctx.String("procfile") == "" {
+		reload = tasksReloader(ctx, tseries)
 	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
+	if reload != nil && !ctx.Bool("no-reload") {
+		stopWatch, err := watchTasksFile(ctx, reload)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Tasks file reload disabled: %s\n", err)
+		} else {
+			defer stopWatch()
+		}
+	}
 
-	go func() {
-		<-sigChan
-		tseries.Stop()
-	}()
+	if !ctx.Bool("no-control") {
+		addr, err := controlAddr(ctx)
+		if err != nil {
+			return abort(err)
+		}
+
+		closeControl, err := serveControl(addr, tseries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Control endpoint disabled: %s\n", err)
+		} else {
+			defer closeControl()
+		}
+	}
+
+	if addr := ctx.String("ui"); addr != "" {
+		closeDashboard, err := serveDashboard(addr, ctx.String("ui-token"), tseries)
+		if err != nil {
+			return abort(err)
+		}
+
+		defer closeDashboard()
+	}
+
+	if addr := ctx.String("hook"); addr != "" {
+		closeHook, err := serveHook(addr, ctx.String("hook-secret"), tseries)
+		if err != nil {
+			return abort(err)
+		}
+
+		defer closeHook()
+	}
+
+	defer handleSignals(tseries, reload)()
 
 	tseries.Wait()
 
-	return nil
+	return writeReports(tseries, started, ctx.String("junit"), ctx.String("report"))
 }
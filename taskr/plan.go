@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+// printPlan prints the plan of the series in the giving format, text if empty.
+func printPlan(series *tasks.TsonSeries, format string) error {
+	plans, err := series.Plan()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "", "text":
+		printTextPlan(plans)
+		return nil
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plans)
+	default:
+		return fmt.Errorf("Unknown plan format %q, expected text or json", format)
+	}
+}
+
+// printTextPlan prints the giving plans in a readable form.
+func printTextPlan(plans []tasks.TsonPlan) {
+	fmt.Println("Tsons run at the same time, as do the master tasks of each Tson.")
+
+	for _, tson := range plans {
+		fmt.Printf("\nTson: %q\n", tson.Name)
+
+		if tson.Description != "" {
+			fmt.Printf("  Description: %s\n", tson.Description)
+		}
+
+		switch {
+		case tson.Schedule != "":
+			fmt.Printf("  Runs: on schedule %q (overlap: %s)\n", tson.Schedule, tson.Overlap)
+		case len(tson.Watch) != 0:
+			fmt.Println("  Runs: on start, then on changes")
+		default:
+			fmt.Println("  Runs: once on start")
+		}
+
+		if len(tson.Watch) != 0 {
+			events := tson.Events
+			if events == "" {
+				events = "any"
+			}
+
+			fmt.Printf("  Watches (%s events):\n", events)
+			for _, file := range tson.Watch {
+				fmt.Printf("    %s\n", file)
+			}
+		}
+
+		if tson.MaxParallel > 0 {
+			fmt.Printf("  Max parallel: %d\n", tson.MaxParallel)
+		}
+
+		for _, mt := range tson.Tasks {
+			fmt.Printf("\n  Master Task: %q\n", mt.Name)
+
+			if mt.Matrix != "" {
+				fmt.Printf("    Matrix: %q\n", mt.Matrix)
+			}
+
+			if mt.If != nil {
+				fmt.Printf("    If: %s\n", conditionText(mt.If))
+			}
+
+			for _, tk := range mt.Tasks {
+				printTaskPlan(tk)
+			}
+		}
+
+		if len(tson.Teardown) != 0 {
+			fmt.Printf("\n  Teardown (after stopping within %s):\n", tson.StopTimeout)
+
+			for _, tk := range tson.Teardown {
+				printTaskPlan(tk)
+			}
+		}
+	}
+}
+
+// printTaskPlan prints the giving task plan as a numbered step.
+func printTaskPlan(tk tasks.TaskPlan) {
+	fmt.Printf("    %d. [%s] %s\n", tk.Step, tk.Stage, tk.Name)
+	fmt.Printf("       Run: %s\n", tk.CommandLine)
+
+	if tk.Type != tasks.TypeExec {
+		fmt.Printf("       Type: %s\n", tk.Type)
+	}
+
+	fmt.Printf("       Dir: %s\n", tk.Dir)
+
+	if len(tk.Env) != 0 {
+		fmt.Printf("       Env: %s\n", strings.Join(tasks.EnvList(tk.Env), " "))
+	}
+
+	timeout := tk.Timeout
+	if timeout == "" {
+		timeout = "none"
+	}
+
+	fmt.Printf("       Timeout: %s\n", timeout)
+
+	if tk.Retries > 0 {
+		fmt.Printf("       Retries: %d\n", tk.Retries)
+	}
+
+	if tk.Lock != "" {
+		fmt.Printf("       Lock: %s\n", tk.Lock)
+	}
+
+	if tk.Interactive {
+		fmt.Println("       Interactive: attached to terminal")
+	}
+
+	if tk.TTY {
+		fmt.Println("       TTY: runs under a pseudo-terminal")
+	}
+
+	if tk.If != nil {
+		fmt.Printf("       If: %s\n", conditionText(tk.If))
+	}
+}
+
+// conditionText describes the checks of the giving condition.
+func conditionText(cond *tasks.Condition) string {
+	var checks []string
+
+	if cond.Env != "" {
+		checks = append(checks, "env "+cond.Env)
+	}
+
+	if cond.Exists != "" {
+		checks = append(checks, "exists "+cond.Exists)
+	}
+
+	if len(cond.Command) != 0 {
+		checks = append(checks, "command "+strings.Join(cond.Command, " "))
+	}
+
+	if cond.Changed != "" {
+		checks = append(checks, "changed "+cond.Changed)
+	}
+
+	text := strings.Join(checks, " and ")
+	if cond.Not {
+		text = "not (" + text + ")"
+	}
+
+	return text
+}
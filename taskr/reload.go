@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/influx6/clis/taskr/tasks"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// reloadDelay sets how long changes to the tasks files must settle before the
+// series is reloaded, as editors often write a file in several steps.
+const reloadDelay = 200 * time.Millisecond
+
+// tasksReloader returns a function which reloads the series from the tasks
+// files, keeping the running tasks if they are invalid.
+func tasksReloader(ctx *cli.Context, series *tasks.TsonSeries) func() {
+	return func() {
+		next, err := loadSeries(ctx)
+		if err == nil {
+			var result tasks.ReloadResult
+			if result, err = series.Reload(next.Tasks); err == nil {
+				fmt.Printf("Reloaded tasks file: %s\n", result)
+				return
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "Tasks file not reloaded, keeping the running tasks: %s\n", err)
+	}
+}
+
+// watchTasksFile calls the giving reload function whenever the tasks file or
+// the global tasks file changes. It returns a function to stop watching.
+func watchTasksFile(ctx *cli.Context, reload func()) (func(), error) {
+	userFile, err := tasksFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{userFile}
+
+	if !ctx.Bool("no-global") {
+		if globalFile, err := globalTasksFile(); err == nil {
+			if globalFile, err = filepath.Abs(globalFile); err == nil {
+				files = append(files, globalFile)
+			}
+		}
+	}
+
+	// Directories are watched instead of the files, as editors often replace a
+	// file when saving it.
+	var dirs []string
+	watched := make(map[string]bool)
+
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if watched[dir] {
+			continue
+		}
+
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			watched[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	var ml sync.Mutex
+	var timer *time.Timer
+
+	watcher := tasks.NewFileSystemWatch(dirs, func(ev fsnotify.Event) {
+		for _, file := range files {
+			if ev.Name != file {
+				continue
+			}
+
+			ml.Lock()
+			defer ml.Unlock()
+
+			if timer != nil {
+				timer.Stop()
+			}
+
+			timer = time.AfterFunc(reloadDelay, reload)
+			return
+		}
+	}, func(err error) {
+		fmt.Fprintf(os.Stderr, "Tasks file watch failed: %s\n", err)
+	})
+
+	if err := watcher.Begin(); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ml.Lock()
+		if timer != nil {
+			timer.Stop()
+		}
+		ml.Unlock()
+
+		watcher.Stop()
+	}, nil
+}
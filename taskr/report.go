@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/influx6/clis/taskr/tasks"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// errTasksFailed is returned to exit with a failure when a task of a run which
+// ran once failed or timed out.
+var errTasksFailed = cli.Exit("One or more tasks failed", 1)
+
+// runReport defines the outcome of a taskr run, written as the JSON report.
+type runReport struct {
+	Started  time.Time          `json:"started"`
+	Ended    time.Time          `json:"ended"`
+	Duration string             `json:"duration"`
+	Passed   bool               `json:"passed"`
+	Counts   map[string]int     `json:"counts"`
+	Tsons    []tasks.TsonStatus `json:"tsons"`
+}
+
+// newRunReport returns the report of the series which started at the giving time.
+func newRunReport(series *tasks.TsonSeries, started time.Time) runReport {
+	report := runReport{
+		Started: started,
+		Ended:   time.Now(),
+		Passed:  true,
+		Counts:  make(map[string]int),
+		Tsons:   series.Status(),
+	}
+
+	report.Duration = report.Ended.Sub(started).Round(time.Millisecond).String()
+
+	eachResult(report.Tsons, func(tson tasks.TsonStatus, mt tasks.MasterTaskStatus, res tasks.TaskResult) {
+		report.Counts[res.Status]++
+
+		if failedResult(res) {
+			report.Passed = false
+		}
+	})
+
+	return report
+}
+
+// eachResult calls the giving function with every task result of the giving
+// Tsons, in the order the tasks run.
+func eachResult(tsons []tasks.TsonStatus, fn func(tasks.TsonStatus, tasks.MasterTaskStatus, tasks.TaskResult)) {
+	for _, tson := range tsons {
+		for _, mt := range tson.Tasks {
+			for _, res := range mt.Before {
+				fn(tson, mt, res)
+			}
+
+			fn(tson, mt, mt.Main)
+
+			for _, res := range mt.After {
+				fn(tson, mt, res)
+			}
+		}
+
+		for _, res := range tson.Teardown {
+			fn(tson, tasks.MasterTaskStatus{Name: tasks.StageTeardown}, res)
+		}
+	}
+}
+
+// failedResult returns true/false if the giving result counts as a failure.
+func failedResult(res tasks.TaskResult) bool {
+	return res.Status == tasks.StatusFailed || res.Status == tasks.StatusTimedOut
+}
+
+// retries returns the number of times the task of the giving result retried.
+func retries(res tasks.TaskResult) int {
+	if res.Attempts <= 1 {
+		return 0
+	}
+
+	return res.Attempts - 1
+}
+
+// printSummary writes the summary table of the report.
+func printSummary(w io.Writer, report runReport) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "\nTSON\tTASK\tSTATUS\tEXIT\tDURATION\tRETRIES")
+
+	eachResult(report.Tsons, func(tson tasks.TsonStatus, mt tasks.MasterTaskStatus, res tasks.TaskResult) {
+		exitCode := "-"
+		if !res.Ended.IsZero() {
+			exitCode = fmt.Sprint(res.ExitCode)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", tson.Name, res.Name, res.Status, exitCode, res.Duration().Round(time.Millisecond), retries(res))
+	})
+
+	tw.Flush()
+
+	outcome := "PASSED"
+	if !report.Passed {
+		outcome = "FAILED"
+	}
+
+	fmt.Fprintf(w, "\n%s in %s (%d done, %d failed, %d timed out, %d skipped, %d stopped)\n", outcome, report.Duration,
+		report.Counts[tasks.StatusDone], report.Counts[tasks.StatusFailed], report.Counts[tasks.StatusTimedOut],
+		report.Counts[tasks.StatusSkipped], report.Counts[tasks.StatusStopped])
+}
+
+// writeJSONReport writes the report as JSON into the giving file.
+func writeJSONReport(path string, report runReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// junitSuites defines the root of a JUnit XML report.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+// junitSuite defines a JUnit test suite, one for each Tson.
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+// junitCase defines a JUnit test case, one for each task.
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+// junitMessage defines the failure or skip message of a JUnit test case.
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes the report as JUnit XML into the giving file, with a
+// test suite for each Tson and a test case for each task. Failed and timed out
+// tasks are failures, while skipped, stopped and pending tasks are skipped.
+func writeJUnitReport(path string, report runReport) error {
+	suites := junitSuites{Time: junitTime(report.Ended.Sub(report.Started))}
+	index := make(map[string]int)
+	durations := make(map[string]time.Duration)
+
+	eachResult(report.Tsons, func(tson tasks.TsonStatus, mt tasks.MasterTaskStatus, res tasks.TaskResult) {
+		at, ok := index[tson.Name]
+		if !ok {
+			at = len(suites.Suites)
+			index[tson.Name] = at
+			suites.Suites = append(suites.Suites, junitSuite{
+				Name:      tson.Name,
+				Timestamp: report.Started.Format("2006-01-02T15:04:05"),
+			})
+		}
+
+		suite := &suites.Suites[at]
+		durations[tson.Name] += res.Duration()
+
+		tc := junitCase{
+			Name:      res.Name,
+			ClassName: tson.Name + "." + mt.Name,
+			Time:      junitTime(res.Duration()),
+		}
+
+		switch {
+		case failedResult(res):
+			message := fmt.Sprintf("%s with exit code %d", res.Status, res.ExitCode)
+			tc.Failure = &junitMessage{Message: message, Text: res.Error}
+			suite.Failures++
+		case res.Status != tasks.StatusDone:
+			tc.Skipped = &junitMessage{Message: res.Status}
+			suite.Skipped++
+		}
+
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	})
+
+	for index, suite := range suites.Suites {
+		suites.Suites[index].Time = junitTime(durations[suite.Name])
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+// junitTime returns the giving duration in seconds as JUnit reports expect.
+func junitTime(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
+
+// writeReports writes the summary of the series when it ran once, and the
+// report files set by the junit and report flags. It returns an error if the
+// series ran once and any task failed.
+func writeReports(series *tasks.TsonSeries, started time.Time, junitPath, reportPath string) error {
+	report := newRunReport(series, started)
+
+	if series.OneShot() {
+		printSummary(os.Stdout, report)
+	}
+
+	if junitPath != "" {
+		if err := writeJUnitReport(junitPath, report); err != nil {
+			return err
+		}
+	}
+
+	if reportPath != "" {
+		if err := writeJSONReport(reportPath, report); err != nil {
+			return err
+		}
+	}
+
+	if series.OneShot() && !report.Passed {
+		return errTasksFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influx6/clis/taskr/tasks"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// sampleReport returns the report of a failed run of a web Tson, holding a
+// task of each status along with a teardown task.
+func sampleReport() runReport {
+	started := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	result := func(name string, status string, exitCode int, took time.Duration) tasks.TaskResult {
+		res := tasks.TaskResult{Name: name, Status: status, ExitCode: exitCode, Attempts: 1}
+		if status != tasks.StatusPending {
+			res.Started = started
+			res.Ended = started.Add(took)
+		}
+
+		return res
+	}
+
+	failed := result("test", tasks.StatusFailed, 2, 1500*time.Millisecond)
+	failed.Error = "exit status 2"
+	failed.Attempts = 3
+
+	timedOut := result("lint", tasks.StatusTimedOut, -1, 2*time.Second)
+	timedOut.Error = "timed out after 2s"
+
+	tsons := []tasks.TsonStatus{
+		{
+			Name: "web",
+			Tasks: []tasks.MasterTaskStatus{
+				{
+					Name:   "build",
+					Before: []tasks.TaskResult{result("deps", tasks.StatusDone, 0, 250*time.Millisecond)},
+					Main:   failed,
+					After:  []tasks.TaskResult{result("notify", tasks.StatusSkipped, 0, 0)},
+				},
+				{
+					Name: "lint",
+					Main: timedOut,
+				},
+			},
+			Teardown: []tasks.TaskResult{result("clean", tasks.StatusStopped, -1, 100*time.Millisecond)},
+		},
+		{
+			Name: "docs",
+			Tasks: []tasks.MasterTaskStatus{
+				{
+					Name: "docs",
+					Main: result("docs", tasks.StatusPending, 0, 0),
+				},
+			},
+		},
+	}
+
+	return runReport{
+		Started:  started,
+		Ended:    started.Add(4 * time.Second),
+		Duration: "4s",
+		Passed:   false,
+		Counts: map[string]int{
+			tasks.StatusDone:     1,
+			tasks.StatusFailed:   1,
+			tasks.StatusTimedOut: 1,
+			tasks.StatusSkipped:  1,
+			tasks.StatusStopped:  1,
+			tasks.StatusPending:  1,
+		},
+		Tsons: tsons,
+	}
+}
+
+func TestJUnitReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	if err := writeJUnitReport(path, sampleReport()); err != nil {
+		t.Fatalf("Should have written report: %q", err.Error())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Should have read report: %q", err.Error())
+	}
+
+	if !bytes.HasPrefix(data, []byte(xml.Header)) {
+		t.Fatalf("Should have written xml header: %s", data)
+	}
+
+	var suites junitSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("Should have decoded report: %q", err.Error())
+	}
+
+	if suites.Tests != 6 || suites.Failures != 2 || suites.Skipped != 3 || suites.Time != "4.000" {
+		t.Fatalf("Should have totals of all suites: %+v", suites)
+	}
+
+	if len(suites.Suites) != 2 {
+		t.Fatalf("Should have a suite for each tson: %+v", suites.Suites)
+	}
+
+	web := suites.Suites[0]
+	if web.Name != "web" || web.Tests != 5 || web.Failures != 2 || web.Skipped != 2 {
+		t.Fatalf("Should have counts of web suite: %+v", web)
+	}
+
+	if web.Time != "3.850" || web.Timestamp != "2024-03-01T10:00:00" {
+		t.Fatalf("Should have summed task times of web suite: %q %q", web.Time, web.Timestamp)
+	}
+
+	cases := make(map[string]junitCase)
+	for _, tc := range web.Cases {
+		cases[tc.Name] = tc
+	}
+
+	if tc := cases["deps"]; tc.ClassName != "web.build" || tc.Time != "0.250" || tc.Failure != nil || tc.Skipped != nil {
+		t.Fatalf("Should have passed deps case: %+v", tc)
+	}
+
+	if tc := cases["test"]; tc.Failure == nil || tc.Failure.Message != "failed with exit code 2" || tc.Failure.Text != "exit status 2" || tc.Time != "1.500" {
+		t.Fatalf("Should have failed test case: %+v", tc)
+	}
+
+	if tc := cases["lint"]; tc.Failure == nil || tc.Failure.Message != "timed out with exit code -1" || tc.Failure.Text != "timed out after 2s" {
+		t.Fatalf("Should have failed timed out lint case: %+v", tc)
+	}
+
+	if tc := cases["notify"]; tc.Skipped == nil || tc.Skipped.Message != tasks.StatusSkipped || tc.Failure != nil {
+		t.Fatalf("Should have skipped notify case: %+v", tc)
+	}
+
+	if tc := cases["clean"]; tc.ClassName != "web.teardown" || tc.Skipped == nil || tc.Skipped.Message != tasks.StatusStopped {
+		t.Fatalf("Should have skipped stopped teardown case: %+v", tc)
+	}
+
+	docs := suites.Suites[1]
+	if len(docs.Cases) != 1 || docs.Cases[0].Skipped == nil || docs.Cases[0].Skipped.Message != tasks.StatusPending || docs.Time != "0.000" {
+		t.Fatalf("Should have skipped pending docs case: %+v", docs)
+	}
+}
+
+func TestJSONReport(t *testing.T) {
+	report := sampleReport()
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := writeJSONReport(path, report); err != nil {
+		t.Fatalf("Should have written report: %q", err.Error())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Should have read report: %q", err.Error())
+	}
+
+	var decoded runReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Should have decoded report: %q", err.Error())
+	}
+
+	if decoded.Passed || decoded.Duration != "4s" || !decoded.Started.Equal(report.Started) || !decoded.Ended.Equal(report.Ended) {
+		t.Fatalf("Should have outcome of run: %+v", decoded)
+	}
+
+	if decoded.Counts[tasks.StatusFailed] != 1 || decoded.Counts[tasks.StatusDone] != 1 || len(decoded.Counts) != 6 {
+		t.Fatalf("Should have counts of run: %+v", decoded.Counts)
+	}
+
+	main := decoded.Tsons[0].Tasks[0].Main
+	if main.Name != "test" || main.ExitCode != 2 || main.Attempts != 3 || main.Error != "exit status 2" {
+		t.Fatalf("Should have result of failed task: %+v", main)
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	var out bytes.Buffer
+	printSummary(&out, sampleReport())
+
+	summary := out.String()
+
+	for _, line := range []string{
+		"TSON  TASK    STATUS     EXIT  DURATION  RETRIES",
+		"web   deps    done       0     250ms     0",
+		"web   test    failed     2     1.5s      2",
+		"web   lint    timed out  -1    2s        0",
+		"web   clean   stopped    -1    100ms     0",
+		"docs  docs    pending    -     0s        0",
+		"FAILED in 4s (1 done, 1 failed, 1 timed out, 1 skipped, 1 stopped)",
+	} {
+		if !strings.Contains(summary, line) {
+			t.Fatalf("Should have printed %q in summary:\n%s", line, summary)
+		}
+	}
+
+	report := sampleReport()
+	report.Passed = true
+
+	out.Reset()
+	printSummary(&out, report)
+
+	if !strings.Contains(out.String(), "PASSED in 4s") {
+		t.Fatalf("Should have printed passed outcome:\n%s", out.String())
+	}
+}
+
+// runOnce runs a series of a single Tson whose main task runs the giving shell
+// script, else the giving command, with TOKEN set to a secret, returning the
+// series once it ended.
+func runOnce(t *testing.T, script string, command string) *tasks.TsonSeries {
+	params := []string{"-c", script}
+	if command == "" {
+		command = "sh"
+	} else {
+		params = nil
+	}
+
+	series := tasks.New(&tasks.Tson{
+		Name:       "ci",
+		Sink:       ioutil.Discard,
+		WriteDelay: "10ms",
+		Secrets:    []string{"TOKEN"},
+		Tasks: []*tasks.MasterTask{
+			{
+				Main: &tasks.Task{
+					Name:       "check",
+					Command:    command,
+					Parameters: params,
+					Env:        map[string]string{"TOKEN": "hunter2"},
+				},
+			},
+		},
+	})
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	series.Wait()
+
+	return series
+}
+
+func TestWriteReports(t *testing.T) {
+	dir := t.TempDir()
+	junitPath := filepath.Join(dir, "junit.xml")
+	reportPath := filepath.Join(dir, "report.json")
+
+	series := runOnce(t, "exit 3", "")
+
+	err := writeReports(series, time.Now(), junitPath, reportPath)
+	if err != errTasksFailed {
+		t.Fatalf("Should have failed run: %v", err)
+	}
+
+	if coder, ok := err.(cli.ExitCoder); !ok || coder.ExitCode() != 1 {
+		t.Fatalf("Should have exited with code 1: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(junitPath)
+	if err != nil {
+		t.Fatalf("Should have written junit report: %q", err.Error())
+	}
+
+	if !bytes.Contains(data, []byte(`<failure message="failed with exit code 3">`)) {
+		t.Fatalf("Should have reported failure: %s", data)
+	}
+
+	if _, err := ioutil.ReadFile(reportPath); err != nil {
+		t.Fatalf("Should have written json report: %q", err.Error())
+	}
+
+	series = runOnce(t, "true", "")
+
+	if err := writeReports(series, time.Now(), "", ""); err != nil {
+		t.Fatalf("Should have passed run: %v", err)
+	}
+}
+
+func TestReportMasksErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "junit.xml")
+
+	// The command does not exist, so the error of the task names its path,
+	// which holds the secret.
+	series := runOnce(t, "", "/nonexistent/hunter2")
+
+	if err := writeReports(series, time.Now(), path, ""); err != errTasksFailed {
+		t.Fatalf("Should have failed run: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Should have written junit report: %q", err.Error())
+	}
+
+	if bytes.Contains(data, []byte("hunter2")) || !bytes.Contains(data, []byte("/nonexistent/********")) {
+		t.Fatalf("Should have masked secret in error: %s", data)
+	}
+}
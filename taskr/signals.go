@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+// handleSignals stops the series on SIGINT or SIGTERM, giving its tasks their
+// stop timeout to exit and running the teardown tasks, and kills them when
+// either signal is received again. SIGHUP reloads the tasks file with the
+// giving reload function, else it stops the series as well. It returns a
+// function to stop handling signals.
+func handleSignals(series *tasks.TsonSeries, reload func()) func() {
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	done := make(chan struct{})
+
+	go func() {
+		var stopping bool
+
+		for {
+			var sig os.Signal
+
+			select {
+			case sig = <-sigChan:
+			case <-done:
+				return
+			}
+
+			if sig == syscall.SIGHUP && reload != nil && !stopping {
+				fmt.Println("Received hangup, reloading tasks file")
+				go reload()
+				continue
+			}
+
+			if stopping {
+				fmt.Fprintf(os.Stderr, "Received %s again, killing tasks\n", sig)
+				series.Kill()
+				continue
+			}
+
+			stopping = true
+			fmt.Fprintf(os.Stderr, "Received %s, stopping tasks (press Ctrl-C again to kill them)\n", sig)
+			go series.Stop()
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/influx6/clis/taskr/tasks"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// statsDir is the directory within the user cache directory which the results
+// of tasks are recorded into, with a stats file for each project.
+const statsDir = "taskr/stats"
+
+// maxStatRecords sets how many of the latest results are kept in the stats
+// file when taskr starts.
+const maxStatRecords = 10000
+
+// statsFile returns the path of the stats file, which is the file set by the
+// stats flag, else the stats file of the directory of the Procfile or tasks
+// file within the user cache directory, keeping it out of the project.
+func statsFile(ctx *cli.Context) (string, error) {
+	if path := ctx.String("stats"); path != "" {
+		return path, nil
+	}
+
+	name, hash, err := projectID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cache, filepath.FromSlash(statsDir), name+"-"+hash+".jsonl"), nil
+}
+
+// openStats returns the stats log of the run, trimming it to the latest
+// results, else nil if disabled by the no-stats flag.
+func openStats(ctx *cli.Context) *tasks.StatsLog {
+	if ctx.Bool("no-stats") {
+		return nil
+	}
+
+	path, err := statsFile(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Stats recording disabled: %s\n", err)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Stats recording disabled: %s\n", err)
+		return nil
+	}
+
+	stats := tasks.NewStatsLog(path)
+	if err := stats.Trim(maxStatRecords); err != nil {
+		fmt.Fprintf(os.Stderr, "Stats file not trimmed: %s\n", err)
+	}
+
+	return stats
+}
+
+func showStats(ctx *cli.Context) error {
+	path, err := statsFile(ctx)
+	if err != nil {
+		return err
+	}
+
+	records, err := tasks.ReadStats(path)
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return fmt.Errorf("No task results recorded in %s yet, run some tasks with taskr run first", path)
+	}
+
+	if name := ctx.String("task"); name != "" {
+		return printTaskRuns(records, name, ctx.Int("last"), ctx.Bool("json"))
+	}
+
+	stats := tasks.SummarizeStats(records)
+
+	if ctx.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TSON\tTASK\tRUNS\tFAILED\tAVG WALL\tMAX WALL\tAVG USER\tAVG SYSTEM\tPEAK RSS\tTREND\tLAST RUN")
+
+	for _, st := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			st.Tson, st.Task, st.Runs, st.Failed,
+			roundDuration(st.Wall), roundDuration(st.MaxWall),
+			roundDuration(st.User), roundDuration(st.System),
+			formatRSS(st.PeakRSS), formatTrend(st.Trend),
+			st.Last.Local().Format("2006-01-02 15:04"))
+	}
+
+	return w.Flush()
+}
+
+// printTaskRuns prints the latest runs of the named task, else those of all
+// tasks of the Tson with the giving name, oldest first.
+func printTaskRuns(records []tasks.StatRecord, name string, last int, asJSON bool) error {
+	var runs []tasks.StatRecord
+	for _, record := range records {
+		if record.Name == name || record.Tson == name {
+			runs = append(runs, record)
+		}
+	}
+
+	if len(runs) == 0 {
+		return fmt.Errorf("No results recorded for %q", name)
+	}
+
+	if last > 0 && len(runs) > last {
+		runs = runs[len(runs)-last:]
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(runs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tTSON\tTASK\tSTATUS\tEXIT\tWALL\tUSER\tSYSTEM\tMAX RSS")
+
+	for _, run := range runs {
+		usage := tasks.Usage{Wall: run.Duration()}
+		if run.Usage != nil {
+			usage = *run.Usage
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			run.Started.Local().Format("2006-01-02 15:04:05"), run.Tson, run.Name,
+			run.Status, run.ExitCode, roundDuration(usage.Wall),
+			roundDuration(usage.User), roundDuration(usage.System),
+			formatRSS(usage.MaxRSS))
+	}
+
+	return w.Flush()
+}
+
+// roundDuration returns the giving duration rounded for display, else - if
+// it is zero.
+func roundDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+
+	return d.Round(time.Millisecond).String()
+}
+
+// formatRSS returns the giving memory in bytes for display, else - if it is
+// not known.
+func formatRSS(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+
+	return tasks.FormatBytes(n)
+}
+
+// formatTrend returns the giving change of wall time as a percentage, else -
+// if there were too few runs to compare.
+func formatTrend(trend float64) string {
+	if trend == 0 {
+		return "-"
+	}
+
+	percent := math.Round(trend * 100)
+	if percent == 0 {
+		return "0%"
+	}
+
+	return fmt.Sprintf("%+.0f%%", percent)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/influx6/clis/taskr/tasks"
+
+	"gopkg.in/urfave/cli.v2"
+	"gopkg.in/yaml.v2"
+)
+
+// taskFileNames holds the names of tasks files looked for in each directory,
+// in order of preference.
+var taskFileNames = []string{"tasks.json", "tasks.yaml", "tasks.yml", "tasks.toml"}
+
+// tasksFile returns the path of the tasks file to be used, which is the file
+// set by the in flag, else the nearest tasks file found in the current
+// directory or its parents.
+func tasksFile(ctx *cli.Context) (string, error) {
+	if userFile := ctx.String("input"); userFile != "" {
+		return filepath.Abs(userFile)
+	}
+
+	cdir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	return findTasksFile(cdir)
+}
+
+// findTasksFile returns the first tasks file found in the giving directory or
+// its parents, as git does for its repository.
+func findTasksFile(dir string) (string, error) {
+	for current := dir; ; current = filepath.Dir(current) {
+		for _, name := range taskFileNames {
+			path := filepath.Join(current, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		if filepath.Dir(current) == current {
+			return "", fmt.Errorf("No tasks.json, tasks.yaml or tasks.toml found in %s or its parents, create one with taskr init", dir)
+		}
+	}
+}
+
+// projectID returns the name of the directory of the Procfile or tasks file in
+// use along with a short hash of its path, naming the files taskr keeps for the
+// project outside of it apart from those of other projects.
+func projectID(ctx *cli.Context) (string, string, error) {
+	taskFile := ctx.String("procfile")
+	if taskFile == "" {
+		var err error
+		if taskFile, err = tasksFile(ctx); err != nil {
+			return "", "", err
+		}
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(taskFile))
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha1.Sum([]byte(dir))
+	return filepath.Base(dir), hex.EncodeToString(sum[:6]), nil
+}
+
+// globalTasksFile returns the path of the user's global tasks file, whose Tsons
+// are merged into those of every tasks file.
+func globalTasksFile() (string, error) {
+	if path := os.Getenv("TASKR_GLOBAL"); path != "" {
+		return path, nil
+	}
+
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(config, "taskr", "tasks.json"), nil
+}
+
+// readTsons returns the Tsons defined in the giving tasks file, which is read
+// as yaml or toml by its extension, else as json.
+func readTsons(path string) ([]*tasks.Tson, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		data, err = yamlToJSON(data)
+	case ".toml":
+		data, err = tomlToJSON(data)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Tasks file %s: %s", path, err)
+	}
+
+	var taskCol []*tasks.Tson
+
+	if err := json.Unmarshal(data, &taskCol); err != nil {
+		return nil, fmt.Errorf("Tasks file %s: %s", path, err)
+	}
+
+	return taskCol, nil
+}
+
+// yamlToJSON returns the json of the giving yaml tasks file, which holds a
+// list of Tsons as a json tasks file does, so both decode the same.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if doc == nil {
+		doc = []interface{}{}
+	}
+
+	return json.Marshal(jsonValue(doc))
+}
+
+// jsonValue returns the giving yaml value with its maps keyed by strings, as
+// json requires.
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		fields := make(map[string]interface{}, len(value))
+		for key, field := range value {
+			fields[fmt.Sprint(key)] = jsonValue(field)
+		}
+
+		return fields
+	case []interface{}:
+		for index, item := range value {
+			value[index] = jsonValue(item)
+		}
+	}
+
+	return value
+}
+
+// tomlToJSON returns the json of the Tsons of the giving toml tasks file, which
+// defines each Tson as a [[tson]] table.
+func tomlToJSON(data []byte) ([]byte, error) {
+	var doc struct {
+		Tsons []map[string]interface{} `toml:"tson"`
+	}
+
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Tsons == nil {
+		doc.Tsons = []map[string]interface{}{}
+	}
+
+	return json.Marshal(doc.Tsons)
+}
+
+// mergeTsons returns the giving Tsons followed by the global Tsons whose name
+// is not already taken, letting a tasks file override global Tsons.
+func mergeTsons(tsons, global []*tasks.Tson) []*tasks.Tson {
+	taken := make(map[string]bool)
+	for _, tson := range tsons {
+		taken[tson.ID()] = true
+	}
+
+	for _, tson := range global {
+		if !taken[tson.ID()] {
+			tsons = append(tsons, tson)
+		}
+	}
+
+	return tsons
+}
+
+// loadSeries returns the series of Tsons defined in the tasks file merged with
+// the global tasks file, else in the Procfile set by the procfile flag. A tasks
+// file found in a parent directory becomes the working directory, so its tasks
+// run relative to it.
+func loadSeries(ctx *cli.Context) (*tasks.TsonSeries, error) {
+	if procfile := ctx.String("procfile"); procfile != "" {
+		file, err := os.Open(procfile)
+		if err != nil {
+			return nil, err
+		}
+
+		defer file.Close()
+
+		tson, err := tasks.ImportProcfile(procfile, file)
+		if err != nil {
+			return nil, err
+		}
+
+		return tasks.New(tson), nil
+	}
+
+	userFile, err := tasksFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	taskCol, err := readTsons(userFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ctx.IsSet("input") {
+		if err := os.Chdir(filepath.Dir(userFile)); err != nil {
+			return nil, err
+		}
+	}
+
+	if ctx.Bool("no-global") {
+		return tasks.New(taskCol...), nil
+	}
+
+	globalFile, err := globalTasksFile()
+	if err != nil {
+		return tasks.New(taskCol...), nil
+	}
+
+	if _, err := os.Stat(globalFile); err != nil || globalFile == userFile {
+		return tasks.New(taskCol...), nil
+	}
+
+	global, err := readTsons(globalFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks.New(mergeTsons(taskCol, global)...), nil
+}
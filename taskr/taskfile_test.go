@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+func TestFindTasksFile(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "app", "cmd")
+
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Should have created dirs: %q", err.Error())
+	}
+
+	if _, err := findTasksFile(nested); err == nil {
+		t.Fatalf("Should have failed without a tasks file")
+	}
+
+	rootFile := filepath.Join(root, "tasks.json")
+	if err := ioutil.WriteFile(rootFile, []byte("[]"), 0644); err != nil {
+		t.Fatalf("Should have written tasks file: %q", err.Error())
+	}
+
+	if err := os.Mkdir(filepath.Join(nested, "tasks.json"), 0755); err != nil {
+		t.Fatalf("Should have created dir: %q", err.Error())
+	}
+
+	if path, err := findTasksFile(nested); err != nil || path != rootFile {
+		t.Fatalf("Should have found tasks file of parent: %q %v", path, err)
+	}
+
+	tomlFile := filepath.Join(root, "app", "tasks.toml")
+	if err := ioutil.WriteFile(tomlFile, nil, 0644); err != nil {
+		t.Fatalf("Should have written tasks file: %q", err.Error())
+	}
+
+	if path, err := findTasksFile(nested); err != nil || path != tomlFile {
+		t.Fatalf("Should have found nearest tasks file: %q %v", path, err)
+	}
+
+	appFile := filepath.Join(root, "app", "tasks.json")
+	if err := ioutil.WriteFile(appFile, []byte("[]"), 0644); err != nil {
+		t.Fatalf("Should have written tasks file: %q", err.Error())
+	}
+
+	if path, err := findTasksFile(nested); err != nil || path != appFile {
+		t.Fatalf("Should have preferred json tasks file: %q %v", path, err)
+	}
+}
+
+func TestReadTsons(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"tasks.json": `[{
+  "name": "build",
+  "write_delay": "20ms",
+  "files": ["./cmd"],
+  "tasks": [{
+    "matrix_parallel": 2,
+    "main": {"name": "compile", "command": "go", "params": ["build", "./..."], "env": {"CGO_ENABLED": "0"}}
+  }]
+}, {
+  "name": "lint",
+  "tasks": [{"main": {"name": "vet", "command": "go vet"}}]
+}]`,
+		"tasks.yaml": `
+- name: build
+  write_delay: 20ms
+  files: [./cmd]
+  tasks:
+    - matrix_parallel: 2
+      main:
+        name: compile
+        command: go
+        params: [build, ./...]
+        env:
+          CGO_ENABLED: "0"
+- name: lint
+  tasks:
+    - main: {name: vet, command: go vet}
+`,
+		"tasks.toml": `
+[[tson]]
+name = "build"
+write_delay = "20ms"
+files = ["./cmd"]
+
+[[tson.tasks]]
+matrix_parallel = 2
+main = { name = "compile", command = "go", params = ["build", "./..."], env = { CGO_ENABLED = "0" } }
+
+[[tson]]
+name = "lint"
+
+[[tson.tasks]]
+main = { name = "vet", command = "go vet" }
+`,
+	}
+
+	var want string
+
+	for _, name := range []string{"tasks.json", "tasks.yaml", "tasks.toml"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(files[name]), 0644); err != nil {
+			t.Fatalf("Should have written tasks file: %q", err.Error())
+		}
+
+		tsons, err := readTsons(path)
+		if err != nil {
+			t.Fatalf("Should have read %s: %q", name, err.Error())
+		}
+
+		data, err := json.Marshal(tsons)
+		if err != nil {
+			t.Fatalf("Should have encoded Tsons: %q", err.Error())
+		}
+
+		if want == "" {
+			want = string(data)
+			continue
+		}
+
+		if string(data) != want {
+			t.Fatalf("Should have read %s as its json equivalent:\n%s\n%s", name, data, want)
+		}
+	}
+
+	if !strings.Contains(want, `"CGO_ENABLED":"0"`) || !strings.Contains(want, `"matrix_parallel":2`) {
+		t.Fatalf("Should have read fields of Tsons: %s", want)
+	}
+
+	for name, content := range map[string]string{"bad.yaml": "- name: [build", "bad.toml": "[[tson]\nname ="} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Should have written tasks file: %q", err.Error())
+		}
+
+		if _, err := readTsons(path); err == nil || !strings.Contains(err.Error(), path) {
+			t.Fatalf("Should have failed to read %s: %v", name, err)
+		}
+	}
+
+	empty := filepath.Join(dir, "empty.toml")
+	if err := ioutil.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatalf("Should have written tasks file: %q", err.Error())
+	}
+
+	if tsons, err := readTsons(empty); err != nil || len(tsons) != 0 {
+		t.Fatalf("Should have read no Tsons from empty file: %v", err)
+	}
+}
+
+func TestMergeTsons(t *testing.T) {
+	tsons := []*tasks.Tson{{Name: "server"}, {Description: "assets"}}
+	global := []*tasks.Tson{{Name: "lint"}, {Name: "server", Description: "global"}, {Description: "assets"}}
+
+	var names []string
+	for _, tson := range mergeTsons(tsons, global) {
+		names = append(names, tson.ID()+"/"+tson.Description)
+	}
+
+	if got := strings.Join(names, ","); got != "server/,assets/assets,lint/" {
+		t.Fatalf("Should have added global Tsons not defined by tasks file: %q", got)
+	}
+
+	if merged := mergeTsons(tsons, nil); len(merged) != 2 {
+		t.Fatalf("Should have kept Tsons without global ones: %d", len(merged))
+	}
+}
@@ -0,0 +1,268 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Built-in task types which are carried out by taskr itself instead of running
+// a command, taking their arguments from the task's params.
+const (
+	TypeCopy     = "copy"      // params: source, destination
+	TypeRemove   = "remove"    // params: paths...
+	TypeMkdir    = "mkdir"     // params: paths...
+	TypeTemplate = "template"  // params: template file, destination
+	TypeHTTPWait = "http_wait" // params: url, optional poll interval
+	TypeSleep    = "sleep"     // params: duration
+	TypeServe    = "serve"     // params: directory, address
+)
+
+// defaultPollInterval sets the interval between requests of http_wait tasks.
+const defaultPollInterval = 500 * time.Millisecond
+
+func init() {
+	RegisterExecutor(TypeCopy, builtin(2, 2, copyTask))
+	RegisterExecutor(TypeRemove, builtin(1, -1, removeTask))
+	RegisterExecutor(TypeMkdir, builtin(1, -1, mkdirTask))
+	RegisterExecutor(TypeTemplate, builtin(2, 2, templateTask))
+	RegisterExecutor(TypeHTTPWait, builtin(1, 2, httpWaitTask))
+	RegisterExecutor(TypeSleep, builtin(1, 1, sleepTask))
+	RegisterExecutor(TypeServe, builtin(2, 2, serveTask))
+}
+
+// builtin returns an ExecutorMaker for the giving built-in function, which
+// requires at least min params and at most max params if max is positive.
+func builtin(min, max int, fn TaskFunc) ExecutorMaker {
+	return func(t *Task) (Executor, error) {
+		if len(t.Parameters) < min || (max > 0 && len(t.Parameters) > max) {
+			return nil, fmt.Errorf("Task type %q expects %s params", t.Type, paramCount(min, max))
+		}
+
+		return newFuncExecutor(t, fn), nil
+	}
+}
+
+// paramCount describes the number of params expected between min and max.
+func paramCount(min, max int) string {
+	switch {
+	case max <= 0:
+		return fmt.Sprintf("at least %d", min)
+	case min == max:
+		return fmt.Sprint(min)
+	default:
+		return fmt.Sprintf("%d to %d", min, max)
+	}
+}
+
+// copyTask copies a file or directory to the destination, copying into the
+// destination if it is an existing directory.
+func copyTask(ctx context.Context, t *Task, st Streams) error {
+	src, dst := t.Parameters[0], t.Parameters[1]
+
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		dst = filepath.Join(dst, filepath.Base(src))
+	}
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+
+		return copyFile(path, target, info.Mode().Perm())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(st.Stdout, "Copied %s to %s\n", src, dst)
+	return nil
+}
+
+// copyFile copies the giving file to the target with the giving permissions.
+func copyFile(path, target string, perm os.FileMode) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// removeTask removes the giving paths and everything within them.
+func removeTask(ctx context.Context, t *Task, st Streams) error {
+	for _, path := range t.Parameters {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(st.Stdout, "Removed %s\n", path)
+	}
+
+	return nil
+}
+
+// mkdirTask creates the giving directories along with their parents.
+func mkdirTask(ctx context.Context, t *Task, st Streams) error {
+	for _, path := range t.Parameters {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(st.Stdout, "Created %s\n", path)
+	}
+
+	return nil
+}
+
+// templateTask renders a text/template file into the destination, with the
+// environment of the task available as .Env.
+func templateTask(ctx context.Context, t *Task, st Streams) error {
+	src, dst := t.Parameters[0], t.Parameters[1]
+
+	tmpl, err := template.ParseFiles(src)
+	if err != nil {
+		return err
+	}
+
+	env := make(map[string]string)
+	for _, pair := range os.Environ() {
+		if name, value, ok := strings.Cut(pair, "="); ok {
+			env[name] = value
+		}
+	}
+
+	for name, value := range t.Env {
+		env[name] = value
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := tmpl.Execute(out, map[string]interface{}{"Env": env}); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(st.Stdout, "Rendered %s to %s\n", src, dst)
+	return nil
+}
+
+// httpWaitTask polls the giving url until it responds with a success or
+// redirect status, or the task is stopped or times out.
+func httpWaitTask(ctx context.Context, t *Task, st Streams) error {
+	url := t.Parameters[0]
+
+	interval := defaultPollInterval
+	if len(t.Parameters) > 1 {
+		var err error
+		if interval, err = time.ParseDuration(t.Parameters[1]); err != nil {
+			return err
+		}
+	}
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+
+		if res, err := http.DefaultClient.Do(req); err == nil {
+			res.Body.Close()
+
+			if res.StatusCode < 400 {
+				fmt.Fprintf(st.Stdout, "%s responded with %s\n", url, res.Status)
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Gave up waiting for %s: %s", url, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// sleepTask waits for the giving duration.
+func sleepTask(ctx context.Context, t *Task, st Streams) error {
+	duration, err := time.ParseDuration(t.Parameters[0])
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+		return nil
+	}
+}
+
+// serveTask serves the files of the giving directory on the giving address
+// until the task is stopped.
+func serveTask(ctx context.Context, t *Task, st Streams) error {
+	dir, addr := t.Parameters[0], t.Parameters[1]
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: http.FileServer(http.Dir(dir))}
+
+	fmt.Fprintf(st.Stdout, "Serving %s at http://%s\n", dir, listener.Addr())
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
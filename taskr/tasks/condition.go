@@ -0,0 +1,133 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Condition defines the checks which must all hold for a Task or MasterTask to
+// run, else it is skipped. Checks which are not set are ignored.
+type Condition struct {
+	Env     string   `json:"env,omitempty"`
+	Exists  string   `json:"exists,omitempty"`
+	Command []string `json:"command,omitempty"`
+	Changed string   `json:"changed,omitempty"`
+	Not     bool     `json:"not,omitempty"`
+}
+
+// Check returns true/false if the condition holds for the giving changed files,
+// with a description of the check which decided it.
+func (c *Condition) Check(changed []string) (bool, string) {
+	ok, reason := c.check(changed)
+	if c.Not {
+		return !ok, "not " + reason
+	}
+
+	return ok, reason
+}
+
+// check returns true/false if all the checks of the condition hold, with a
+// description of the first which does not, else of all of them.
+func (c *Condition) check(changed []string) (bool, string) {
+	var checks []string
+
+	if c.Env != "" {
+		desc := fmt.Sprintf("env %s set", c.Env)
+
+		name, want, equal := strings.Cut(c.Env, "=")
+		if equal {
+			desc = fmt.Sprintf("env %s equals %q", name, want)
+		}
+
+		value, found := os.LookupEnv(name)
+		if !found || (equal && value != want) {
+			return false, desc
+		}
+
+		checks = append(checks, desc)
+	}
+
+	if c.Exists != "" {
+		desc := fmt.Sprintf("%s exists", c.Exists)
+
+		matches, err := filepath.Glob(c.Exists)
+		if err != nil || len(matches) == 0 {
+			return false, desc
+		}
+
+		checks = append(checks, desc)
+	}
+
+	if len(c.Command) != 0 {
+		desc := fmt.Sprintf("%s exits zero", strings.Join(c.Command, " "))
+
+		if err := exec.Command(c.Command[0], c.Command[1:]...).Run(); err != nil {
+			return false, desc
+		}
+
+		checks = append(checks, desc)
+	}
+
+	if c.Changed != "" {
+		desc := fmt.Sprintf("%s changed", c.Changed)
+
+		if !matchChanged(c.Changed, changed) {
+			return false, desc
+		}
+
+		checks = append(checks, desc)
+	}
+
+	return true, strings.Join(checks, " and ")
+}
+
+// matchChanged returns true/false if any of the changed files matches the
+// giving glob, with files within the working directory matched by their
+// relative path.
+func matchChanged(glob string, changed []string) bool {
+	glob = filepath.Clean(glob)
+	wd, _ := os.Getwd()
+
+	for _, file := range changed {
+		file = filepath.Clean(file)
+
+		if filepath.IsAbs(file) && !filepath.IsAbs(glob) && wd != "" {
+			if rel, err := filepath.Rel(wd, file); err == nil {
+				file = rel
+			}
+		}
+
+		if ok, _ := filepath.Match(glob, file); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+//==============================================================================
+
+// changeSet collects the files changed since it was last taken.
+type changeSet map[string]struct{}
+
+// add records the giving file as changed.
+func (cs changeSet) add(file string) {
+	cs[file] = struct{}{}
+}
+
+// take returns the changed files in order and empties the set.
+func (cs changeSet) take() []string {
+	var files []string
+
+	for file := range cs {
+		files = append(files, file)
+		delete(cs, file)
+	}
+
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,294 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// TypeExec defines the task type which runs the task's command, used when a
+// task sets no type.
+const TypeExec = "exec"
+
+// Streams defines the input and outputs of a single attempt of a task.
+type Streams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Executor defines an interface for types which carry out a single attempt of
+// a task, one being created for each attempt. Errors returned by Wait which
+// have an ExitCode() int method set the exit code of the attempt. Executors
+// running a process may have a Usage() (Usage, bool) method returning the CPU
+// time and memory it used once it ended.
+type Executor interface {
+	// Start begins the attempt with the giving streams, it must end the
+	// attempt once the context is done.
+	Start(ctx context.Context, streams Streams) error
+
+	// Wait blocks until the attempt ends, returning an error if it failed.
+	Wait() error
+
+	// Stop asks the attempt to end early. Executors which can also end an
+	// attempt at once may have a Kill() error method, which is called instead
+	// when taskr is forced to exit.
+	Stop() error
+}
+
+// ExecutorMaker returns a new Executor for an attempt of the giving task,
+// returning an error if the task is not valid for it.
+type ExecutorMaker func(t *Task) (Executor, error)
+
+// TaskFunc defines a function carried out as a task, which must return once
+// the context is done.
+type TaskFunc func(ctx context.Context, t *Task, streams Streams) error
+
+// executors holds the makers for each task type.
+var executors = struct {
+	ml     sync.RWMutex
+	makers map[string]ExecutorMaker
+}{
+	makers: map[string]ExecutorMaker{
+		TypeExec: newExecExecutor,
+	},
+}
+
+// RegisterExecutor sets the maker of executors for tasks of the giving type,
+// replacing any maker already set for it.
+func RegisterExecutor(kind string, maker ExecutorMaker) {
+	executors.ml.Lock()
+	defer executors.ml.Unlock()
+
+	executors.makers[kind] = maker
+}
+
+// RegisterFunc sets the giving function to carry out tasks of the giving type,
+// each attempt running it in its own goroutine whose context is canceled if
+// the task is stopped or times out.
+func RegisterFunc(kind string, fn TaskFunc) {
+	RegisterExecutor(kind, func(t *Task) (Executor, error) {
+		return newFuncExecutor(t, fn), nil
+	})
+}
+
+// newExecutor returns a new Executor for the type of the giving task.
+func newExecutor(t *Task) (Executor, error) {
+	kind := t.Type
+	if kind == "" {
+		kind = TypeExec
+	}
+
+	executors.ml.RLock()
+	maker, ok := executors.makers[kind]
+	executors.ml.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown task type %q", kind)
+	}
+
+	return maker(t)
+}
+
+// exitCode returns the exit code for the giving error returned by an executor.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var coded interface {
+		ExitCode() int
+	}
+
+	if errors.As(err, &coded) {
+		return coded.ExitCode()
+	}
+
+	return -1
+}
+
+//==============================================================================
+
+// execExecutor runs the task's command, under a pseudo-terminal if the task
+// sets TTY and they are supported.
+type execExecutor struct {
+	task *Task
+	cmd  *exec.Cmd
+	pty  *ptyStream
+}
+
+// newExecExecutor returns a new execExecutor for the giving task.
+func newExecExecutor(t *Task) (Executor, error) {
+	if t.Command == "" {
+		return nil, errors.New("Task has no command")
+	}
+
+	return &execExecutor{task: t}, nil
+}
+
+// Start starts the command, which is interrupted once the context is done and
+// then killed if it does not exit.
+func (e *execExecutor) Start(ctx context.Context, st Streams) error {
+	cmd := exec.CommandContext(ctx, e.task.Command, e.task.Parameters...)
+	cmd.Cancel = func() error {
+		return interrupt(cmd.Process)
+	}
+
+	// Commands which do not exit once interrupted, or children of the command
+	// holding its output open, are not waited on for longer than this.
+	cmd.WaitDelay = outputWait
+
+	if len(e.task.Env) != 0 {
+		cmd.Env = os.Environ()
+		for name, value := range e.task.Env {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+
+	if e.task.TTY && ptySupported {
+		pty, err := newPTYStream(cmd, st.Stdout, st.Stdin)
+		if err != nil {
+			t := e.task
+			fmt.Fprintf(st.Stderr, taskError, t.Name, t.Description, t.Command, t.Parameters, err.Error())
+		} else {
+			e.pty = pty
+		}
+	}
+
+	if e.pty == nil {
+		cmd.Stdin = st.Stdin
+		cmd.Stdout = st.Stdout
+		cmd.Stderr = st.Stderr
+	}
+
+	e.cmd = cmd
+
+	if err := cmd.Start(); err != nil {
+		if e.pty != nil {
+			e.pty.Abort()
+		}
+
+		return err
+	}
+
+	if e.pty != nil {
+		e.pty.Begin()
+	}
+
+	return nil
+}
+
+// Wait waits for the command to exit.
+func (e *execExecutor) Wait() error {
+	err := e.cmd.Wait()
+
+	if e.pty != nil {
+		e.pty.End()
+	}
+
+	return err
+}
+
+// Usage returns the CPU time and peak memory used by the command once it has
+// exited.
+func (e *execExecutor) Usage() (Usage, bool) {
+	if e.cmd == nil || e.cmd.ProcessState == nil {
+		return Usage{}, false
+	}
+
+	ps := e.cmd.ProcessState
+
+	return Usage{
+		User:   ps.UserTime(),
+		System: ps.SystemTime(),
+		MaxRSS: maxRSS(ps),
+	}, true
+}
+
+// Stop interrupts the command.
+func (e *execExecutor) Stop() error {
+	if e.cmd == nil || e.cmd.Process == nil {
+		return nil
+	}
+
+	if err := interrupt(e.cmd.Process); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	return nil
+}
+
+// Kill kills the command.
+func (e *execExecutor) Kill() error {
+	if e.cmd == nil || e.cmd.Process == nil {
+		return nil
+	}
+
+	if err := e.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	return nil
+}
+
+// interrupt asks the giving process to end, which is killed instead on windows
+// where interrupts are not supported.
+func interrupt(process *os.Process) error {
+	if runtime.GOOS == "windows" {
+		return process.Kill()
+	}
+
+	return process.Signal(os.Interrupt)
+}
+
+//==============================================================================
+
+// funcExecutor runs a TaskFunc in its own goroutine, which is canceled when
+// the attempt is stopped.
+type funcExecutor struct {
+	task   *Task
+	fn     TaskFunc
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// newFuncExecutor returns a new funcExecutor running the giving function for
+// the giving task.
+func newFuncExecutor(t *Task, fn TaskFunc) *funcExecutor {
+	return &funcExecutor{task: t, fn: fn, done: make(chan struct{})}
+}
+
+// Start runs the function.
+func (f *funcExecutor) Start(ctx context.Context, st Streams) error {
+	ctx, f.cancel = context.WithCancel(ctx)
+
+	go func() {
+		defer close(f.done)
+		f.err = f.fn(ctx, f.task, st)
+	}()
+
+	return nil
+}
+
+// Wait waits for the function to return.
+func (f *funcExecutor) Wait() error {
+	<-f.done
+	f.cancel()
+
+	return f.err
+}
+
+// Stop cancels the context of the function.
+func (f *funcExecutor) Stop() error {
+	if f.cancel != nil {
+		f.cancel()
+	}
+
+	return nil
+}
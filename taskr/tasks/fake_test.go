@@ -0,0 +1,190 @@
+package tasks_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+// fakeRecorder registers a task type carried out by fakeExecutor, recording the
+// names of the tasks it starts and ends in order.
+type fakeRecorder struct {
+	kind    string
+	ml      sync.Mutex
+	started []string
+	ended   []string
+}
+
+// newFakeRecorder returns a new fakeRecorder with a task type unique to the test.
+func newFakeRecorder(t *testing.T) *fakeRecorder {
+	rec := &fakeRecorder{kind: "fake:" + t.Name()}
+
+	tasks.RegisterExecutor(rec.kind, func(tk *tasks.Task) (tasks.Executor, error) {
+		return &fakeExecutor{
+			rec:   rec,
+			task:  tk,
+			stopc: make(chan struct{}),
+			done:  make(chan struct{}),
+		}, nil
+	})
+
+	return rec
+}
+
+// task returns a new task with the giving name and params carried out by a
+// fakeExecutor.
+func (rec *fakeRecorder) task(name string, params ...string) *tasks.Task {
+	return &tasks.Task{Name: name, Type: rec.kind, Parameters: params}
+}
+
+// runs returns the names of the tasks started so far.
+func (rec *fakeRecorder) runs() []string {
+	rec.ml.Lock()
+	defer rec.ml.Unlock()
+
+	return append([]string(nil), rec.started...)
+}
+
+// ends returns the names of the tasks ended so far.
+func (rec *fakeRecorder) ends() []string {
+	rec.ml.Lock()
+	defer rec.ml.Unlock()
+
+	return append([]string(nil), rec.ended...)
+}
+
+// count returns the number of times the named task was started.
+func (rec *fakeRecorder) count(name string) int {
+	var count int
+
+	for _, run := range rec.runs() {
+		if run == name {
+			count++
+		}
+	}
+
+	return count
+}
+
+// fakeExit defines an error carrying an exit code.
+type fakeExit int
+
+// Error returns the exit status.
+func (fe fakeExit) Error() string {
+	return fmt.Sprintf("exit status %d", int(fe))
+}
+
+// ExitCode returns the exit code.
+func (fe fakeExit) ExitCode() int {
+	return int(fe)
+}
+
+// fakeExecutor carries out a task without running a command, writing each of
+// the task's params as a line of output. A "fail" param ends it with exit code
+// 1, a "block" param blocks it until it is stopped and a "stubborn" param
+// blocks it until it is killed.
+type fakeExecutor struct {
+	rec   *fakeRecorder
+	task  *tasks.Task
+	stop  sync.Once
+	stopc chan struct{}
+	done  chan struct{}
+	err   error
+}
+
+// Start records the task and carries it out.
+func (fe *fakeExecutor) Start(ctx context.Context, streams tasks.Streams) error {
+	fe.rec.ml.Lock()
+	fe.rec.started = append(fe.rec.started, fe.task.Name)
+	fe.rec.ml.Unlock()
+
+	go func() {
+		defer close(fe.done)
+		defer func() {
+			fe.rec.ml.Lock()
+			fe.rec.ended = append(fe.rec.ended, fe.task.Name)
+			fe.rec.ml.Unlock()
+		}()
+
+		for _, param := range fe.task.Parameters {
+			switch param {
+			case "fail":
+				fe.err = fakeExit(1)
+				return
+			case "block":
+				select {
+				case <-fe.stopc:
+					fe.err = fakeExit(130)
+					return
+				case <-ctx.Done():
+					fe.err = ctx.Err()
+					return
+				}
+			case "stubborn":
+				<-ctx.Done()
+				fe.err = ctx.Err()
+				return
+			default:
+				fmt.Fprintln(streams.Stdout, param)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Wait waits for the task to end.
+func (fe *fakeExecutor) Wait() error {
+	<-fe.done
+	return fe.err
+}
+
+// Stop ends a blocked task.
+func (fe *fakeExecutor) Stop() error {
+	fe.stop.Do(func() {
+		close(fe.stopc)
+	})
+
+	return nil
+}
+
+// waitFor polls the giving check until it returns true, failing the test if it
+// does not within a few seconds.
+func waitFor(t *testing.T, desc string, check func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting: %s", desc)
+		}
+
+		<-time.After(5 * time.Millisecond)
+	}
+}
+
+// syncBuffer defines a bytes.Buffer safe for use by concurrent writers.
+type syncBuffer struct {
+	ml  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write writes the giving bytes into the buffer.
+func (sb *syncBuffer) Write(bu []byte) (int, error) {
+	sb.ml.Lock()
+	defer sb.ml.Unlock()
+
+	return sb.buf.Write(bu)
+}
+
+// String returns the contents of the buffer.
+func (sb *syncBuffer) String() string {
+	sb.ml.Lock()
+	defer sb.ml.Unlock()
+
+	return sb.buf.String()
+}
@@ -0,0 +1,59 @@
+package tasks
+
+import "sync"
+
+// feedBuffer sets the number of pending writes a subscriber may have before
+// further writes are dropped for it.
+const feedBuffer = 64
+
+// LogFeed defines a writer which broadcasts all writes to it's subscribers.
+// Writes never block, a subscriber which falls behind misses writes instead.
+type LogFeed struct {
+	ml   sync.Mutex
+	subs map[chan []byte]struct{}
+}
+
+// Subscribe returns a channel which receives all writes to the feed and a
+// function to end the subscription.
+func (lf *LogFeed) Subscribe() (<-chan []byte, func()) {
+	sub := make(chan []byte, feedBuffer)
+
+	lf.ml.Lock()
+	if lf.subs == nil {
+		lf.subs = make(map[chan []byte]struct{})
+	}
+	lf.subs[sub] = struct{}{}
+	lf.ml.Unlock()
+
+	var once sync.Once
+
+	return sub, func() {
+		once.Do(func() {
+			lf.ml.Lock()
+			delete(lf.subs, sub)
+			lf.ml.Unlock()
+		})
+	}
+}
+
+// Write sends a copy of the giving bytes to all subscribers.
+func (lf *LogFeed) Write(bu []byte) (int, error) {
+	lf.ml.Lock()
+	defer lf.ml.Unlock()
+
+	if len(lf.subs) == 0 {
+		return len(bu), nil
+	}
+
+	data := make([]byte, len(bu))
+	copy(data, bu)
+
+	for sub := range lf.subs {
+		select {
+		case sub <- data:
+		default:
+		}
+	}
+
+	return len(bu), nil
+}
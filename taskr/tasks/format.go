@@ -27,10 +27,33 @@ var (
 	 %s
 `
 
+	taskUsage = `	 Usage: %s
+`
+
 	taskBegin = `
 	Starting Task: %q - (%q)
 `
 
+	taskInteractive = `
+	Attaching Task To Terminal: %q - (%q)
+`
+
+	taskWaitLock = `
+	Waiting For Lock: %q - (%q)
+`
+
+	taskRetry = `
+	Retrying Task: %q - (attempt %d of %d failed with exit code %d, retrying in %s)
+`
+
+	taskSkip = `
+	Skipping Task: %q - (condition failed: %s)
+`
+
+	taskTimeout = `
+	Task Timed Out: %q - (after %s)
+`
+
 	taskEnd = `
 	Stopping Task: %q - (%q)
 `
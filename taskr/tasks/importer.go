@@ -0,0 +1,243 @@
+package tasks
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// importWriteDelay sets the write delay of Tsons created by the importers.
+const importWriteDelay = "20ms"
+
+// Import returns a Tson with the commands of the giving Procfile, package.json
+// or Makefile, choosing the importer by the name of the file.
+func Import(path string) (*Tson, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	base := filepath.Base(path)
+
+	switch {
+	case base == "Procfile" || strings.HasPrefix(base, "Procfile."):
+		return ImportProcfile(path, file)
+	case base == "package.json":
+		return ImportPackageJSON(path, file)
+	case base == "Makefile" || base == "makefile" || base == "GNUmakefile" || filepath.Ext(base) == ".mk":
+		return ImportMakefile(path, file)
+	default:
+		return nil, fmt.Errorf("Unable to import %q, expected a Procfile, package.json or Makefile", path)
+	}
+}
+
+// procfileLine matches a process of a Procfile as name: command.
+var procfileLine = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+// ImportProcfile returns a Tson running each process of the Procfile read from
+// the giving reader as a service, a main task which runs its command through the
+// shell until it is stopped.
+func ImportProcfile(path string, r io.Reader) (*Tson, error) {
+	tson := newImportedTson(path)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		match := procfileLine.FindStringSubmatch(text)
+		if match == nil {
+			return nil, fmt.Errorf("%s:%d: expected name: command", path, line)
+		}
+
+		tson.Tasks = append(tson.Tasks, &MasterTask{
+			Main:    shellTask(match[1], match[2], "Runs the "+match[1]+" process"),
+			Service: true,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(tson.Tasks) == 0 {
+		return nil, fmt.Errorf("%s: no processes found", path)
+	}
+
+	return tson, nil
+}
+
+// ImportPackageJSON returns a Tson running each script of the package.json read
+// from the giving reader, with its pre and post scripts as before and after
+// tasks. Scripts are run through the shell from the directory of the
+// package.json with its node_modules/.bin on their PATH, as npm runs them.
+func ImportPackageJSON(path string, r io.Reader) (*Tson, error) {
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&pkg); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if len(pkg.Scripts) == 0 {
+		return nil, fmt.Errorf("%s: no scripts found", path)
+	}
+
+	var names []string
+	for name := range pkg.Scripts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	tson := newImportedTson(path)
+	dir := filepath.Dir(path)
+
+	for _, name := range names {
+		if isScriptHook(name, pkg.Scripts) {
+			continue
+		}
+
+		mt := &MasterTask{Main: npmTask(dir, name, pkg.Scripts[name])}
+
+		if script, ok := pkg.Scripts["pre"+name]; ok {
+			mt.Before = append(mt.Before, npmTask(dir, "pre"+name, script))
+		}
+
+		if script, ok := pkg.Scripts["post"+name]; ok {
+			mt.After = append(mt.After, npmTask(dir, "post"+name, script))
+		}
+
+		tson.Tasks = append(tson.Tasks, mt)
+	}
+
+	return tson, nil
+}
+
+// isScriptHook returns true/false if the named script is the pre or post
+// script of another script.
+func isScriptHook(name string, scripts map[string]string) bool {
+	for _, prefix := range []string{"pre", "post"} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if _, ok := scripts[strings.TrimPrefix(name, prefix)]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// npmTask returns a task running the named npm script of the package.json in
+// the giving directory. The script is run directly rather than through npm run,
+// as npm before version 7 does not run the script at all with --ignore-scripts,
+// which is needed to keep npm from running its pre and post scripts again.
+func npmTask(dir, name, script string) *Task {
+	command := `PATH="$PWD/node_modules/.bin:$PATH"; ` + script
+	if dir != "." {
+		command = "cd " + shellQuote(dir) + " && " + command
+	}
+
+	return shellTask(name, command, script)
+}
+
+// shellQuote returns the giving text quoted for the shell.
+func shellQuote(text string) string {
+	return "'" + strings.Replace(text, "'", `'\''`, -1) + "'"
+}
+
+// makeTarget matches the targets of a Makefile rule, with an optional ## help
+// comment, leaving out variable assignments.
+var makeTarget = regexp.MustCompile(`^([^\s:#=][^:#=]*?)\s*::?(?:[^=].*)?$`)
+
+// ImportMakefile returns a Tson running each target of the Makefile read from
+// the giving reader through make, leaving out special targets such as .PHONY
+// and pattern rules. A "## text" comment on a rule is used as its description.
+func ImportMakefile(path string, r io.Reader) (*Tson, error) {
+	tson := newImportedTson(path)
+	seen := make(map[string]bool)
+
+	var params []string
+	switch filepath.Base(path) {
+	case "Makefile", "makefile", "GNUmakefile":
+	default:
+		params = []string{"-f", path}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if strings.HasPrefix(text, "\t") {
+			continue
+		}
+
+		match := makeTarget.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+
+		var desc string
+		if index := strings.Index(text, "##"); index != -1 {
+			desc = strings.TrimSpace(text[index+2:])
+		}
+
+		for _, target := range strings.Fields(match[1]) {
+			if seen[target] || strings.HasPrefix(target, ".") || strings.ContainsAny(target, "%$") {
+				continue
+			}
+
+			seen[target] = true
+
+			tson.Tasks = append(tson.Tasks, &MasterTask{
+				Main: &Task{
+					Name:        target,
+					Command:     "make",
+					Parameters:  append(append([]string(nil), params...), target),
+					Description: desc,
+				},
+			})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(tson.Tasks) == 0 {
+		return nil, fmt.Errorf("%s: no targets found", path)
+	}
+
+	return tson, nil
+}
+
+// newImportedTson returns a Tson named after the file it is imported from.
+func newImportedTson(path string) *Tson {
+	return &Tson{
+		Name:        filepath.Base(path),
+		Description: "Imported from " + path,
+		WriteDelay:  importWriteDelay,
+	}
+}
+
+// shellTask returns a task running the giving command line through the shell.
+func shellTask(name, command, desc string) *Task {
+	return &Task{
+		Name:        name,
+		Command:     "sh",
+		Parameters:  []string{"-c", command},
+		Description: desc,
+	}
+}
@@ -0,0 +1,128 @@
+package tasks_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+func TestImportProcfile(t *testing.T) {
+	procfile := "# services\nweb: ./server --port $PORT\n\nworker: bin/worker -q default\n"
+
+	tson, err := tasks.ImportProcfile("Procfile", strings.NewReader(procfile))
+	if err != nil {
+		t.Fatalf("Should have imported Procfile: %q", err.Error())
+	}
+
+	if len(tson.Tasks) != 2 || tson.Name != "Procfile" {
+		t.Fatalf("Should have imported each process: %+v", tson.Tasks)
+	}
+
+	web := tson.Tasks[0].Main
+	if web.Name != "web" || web.Command != "sh" || strings.Join(web.Parameters, " ") != "-c ./server --port $PORT" {
+		t.Fatalf("Should have run process through the shell: %+v", web)
+	}
+
+	if !tson.Tasks[0].Service || !tson.Tasks[1].Service {
+		t.Fatal("Should have imported processes as services")
+	}
+
+	if _, err := tasks.ImportProcfile("Procfile", strings.NewReader("web ./server\n")); err == nil {
+		t.Fatal("Should have rejected line without a name")
+	}
+}
+
+func TestImportPackageJSON(t *testing.T) {
+	pkg := `{"scripts": {"build": "tsc", "prebuild": "rm -rf dist", "postbuild": "cp -r static dist", "prepare": "husky install"}}`
+
+	tson, err := tasks.ImportPackageJSON("package.json", strings.NewReader(pkg))
+	if err != nil {
+		t.Fatalf("Should have imported package.json: %q", err.Error())
+	}
+
+	if len(tson.Tasks) != 2 {
+		t.Fatalf("Should have imported scripts without their hooks: %+v", tson.Tasks)
+	}
+
+	build := tson.Tasks[0]
+	if build.Main.Name != "build" || build.Main.Command != "sh" || strings.Join(build.Main.Parameters, " ") != `-c PATH="$PWD/node_modules/.bin:$PATH"; tsc` {
+		t.Fatalf("Should have run script through the shell: %+v", build.Main)
+	}
+
+	if len(build.Before) != 1 || build.Before[0].Name != "prebuild" || len(build.After) != 1 || build.After[0].Name != "postbuild" {
+		t.Fatal("Should have imported pre and post scripts as before and after tasks")
+	}
+
+	if tson.Tasks[1].Main.Name != "prepare" {
+		t.Fatalf("Should have kept script without a matching script as its own: %+v", tson.Tasks[1].Main)
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "web's app", "node_modules", ".bin")
+
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatalf("Should have created dirs: %q", err.Error())
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "greet"), []byte("#!/bin/sh\necho hello from \"$1\"\n"), 0755); err != nil {
+		t.Fatalf("Should have written script: %q", err.Error())
+	}
+
+	pkgFile := filepath.Join(dir, "web's app", "package.json")
+	tson, err = tasks.ImportPackageJSON(pkgFile, strings.NewReader(`{"scripts": {"hello": "greet \"$(basename \"$PWD\")\""}}`))
+	if err != nil {
+		t.Fatalf("Should have imported package.json: %q", err.Error())
+	}
+
+	var buf bytes.Buffer
+	tson.Tasks[0].Main.Run(&buf, &buf)
+
+	if !strings.Contains(buf.String(), "hello from web's app") {
+		t.Fatalf("Should have run script from its directory with node_modules binaries: %q", buf.String())
+	}
+}
+
+func TestImportMakefile(t *testing.T) {
+	makefile := `GO := go
+VERSION = 1.0
+.PHONY: build test
+
+build: deps ## Builds the binary
+	$(GO) build ./...
+
+test lint:
+	$(GO) test ./...
+
+%.o: %.c
+	cc -c $<
+`
+
+	tson, err := tasks.ImportMakefile("Makefile", strings.NewReader(makefile))
+	if err != nil {
+		t.Fatalf("Should have imported Makefile: %q", err.Error())
+	}
+
+	var names []string
+	for _, mt := range tson.Tasks {
+		names = append(names, mt.Main.Name)
+	}
+
+	if strings.Join(names, " ") != "build test lint" {
+		t.Fatalf("Should have imported targets without variables and special rules: %v", names)
+	}
+
+	build := tson.Tasks[0].Main
+	if build.Command != "make" || strings.Join(build.Parameters, " ") != "build" || build.Description != "Builds the binary" {
+		t.Fatalf("Should have run target through make: %+v", build)
+	}
+
+	tson, err = tasks.ImportMakefile("build/rules.mk", strings.NewReader(makefile))
+	if err != nil || strings.Join(tson.Tasks[0].Main.Parameters, " ") != "-f build/rules.mk build" {
+		t.Fatal("Should have passed non-default Makefile to make")
+	}
+}
@@ -0,0 +1,85 @@
+package tasks
+
+import "sync"
+
+// semaphore limits the number of holders at any time, a nil semaphore places
+// no limit.
+type semaphore chan struct{}
+
+// newSemaphore returns a semaphore allowing the giving number of holders, or
+// nil if size is not positive.
+func newSemaphore(size int) semaphore {
+	if size <= 0 {
+		return nil
+	}
+
+	return make(semaphore, size)
+}
+
+// acquire blocks until a slot is free or done is closed, returning false if
+// done was closed.
+func (s semaphore) acquire(done <-chan struct{}) bool {
+	if s == nil {
+		return true
+	}
+
+	select {
+	case s <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// tryAcquire takes a slot if one is free, returning false if none is.
+func (s semaphore) tryAcquire() bool {
+	if s == nil {
+		return true
+	}
+
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a slot acquired from the semaphore.
+func (s semaphore) release() {
+	if s == nil {
+		return
+	}
+
+	<-s
+}
+
+//==============================================================================
+
+// lockGroups provides named locks which tasks hold while running, so tasks
+// sharing a lock name never run at the same time.
+type lockGroups struct {
+	ml    sync.Mutex
+	locks map[string]semaphore
+}
+
+// taskLocks holds the lock groups shared by all tasks.
+var taskLocks lockGroups
+
+// get returns the lock for the giving name.
+func (lg *lockGroups) get(name string) semaphore {
+	lg.ml.Lock()
+	defer lg.ml.Unlock()
+
+	if lg.locks == nil {
+		lg.locks = make(map[string]semaphore)
+	}
+
+	lock, ok := lg.locks[name]
+	if !ok {
+		lock = newSemaphore(1)
+		lg.locks[name] = lock
+	}
+
+	return lock
+}
@@ -0,0 +1,243 @@
+package tasks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// matrixGroup holds the MasterTasks expanded from a single matrix definition,
+// which share a limit on how many of them run at once.
+type matrixGroup struct {
+	name    string
+	slots   semaphore
+	members []int
+}
+
+// MatrixStatus defines the summary of the results of the tasks expanded from a
+// matrix, counting their main tasks by status.
+type MatrixStatus struct {
+	Name   string         `json:"name"`
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts"`
+}
+
+// String returns the summary as counts of each status in order.
+func (ms MatrixStatus) String() string {
+	var statuses []string
+	for status := range ms.Counts {
+		statuses = append(statuses, status)
+	}
+
+	sort.Strings(statuses)
+
+	var counts []string
+	for _, status := range statuses {
+		counts = append(counts, fmt.Sprintf("%d %s", ms.Counts[status], status))
+	}
+
+	return fmt.Sprintf("%d tasks: %s", ms.Total, strings.Join(counts, ", "))
+}
+
+// status returns the summary of the group from the giving tasks of its Tson.
+func (mg *matrixGroup) status(tasks []*MasterTask) MatrixStatus {
+	status := MatrixStatus{
+		Name:   mg.name,
+		Total:  len(mg.members),
+		Counts: make(map[string]int),
+	}
+
+	for _, index := range mg.members {
+		status.Counts[tasks[index].Main.Result().Status]++
+	}
+
+	return status
+}
+
+// done returns true/false if all members of the group are in the finished set.
+func (mg *matrixGroup) done(finished map[int]bool) bool {
+	for _, index := range mg.members {
+		if !finished[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ExpandMatrix returns the MasterTasks the MasterTask expands into, one for each
+// combination of its matrix values, or the MasterTask itself if it has no
+// matrix. Every ${NAME} of a matrix variable in the names, descriptions,
+// commands, params, env and conditions of the tasks is replaced with its value,
+// and the variables are set in the environment of the tasks. Main tasks whose
+// name does not change are named after their values.
+func (mt *MasterTask) ExpandMatrix() ([]*MasterTask, error) {
+	if len(mt.Matrix) == 0 {
+		return []*MasterTask{mt}, nil
+	}
+
+	var names []string
+	for name, values := range mt.Matrix {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("Matrix variable %q has no values", name)
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	combinations := []map[string]string{{}}
+	for _, name := range names {
+		var next []map[string]string
+
+		for _, combination := range combinations {
+			for _, value := range mt.Matrix[name] {
+				vars := map[string]string{name: value}
+				for key, val := range combination {
+					vars[key] = val
+				}
+
+				next = append(next, vars)
+			}
+		}
+
+		combinations = next
+	}
+
+	var expanded []*MasterTask
+
+	for _, vars := range combinations {
+		emt := &MasterTask{
+			If:         mt.If.expand(vars),
+			Main:       mt.Main.expand(vars),
+			Service:    mt.Service,
+			MaxRunTime: mt.MaxRunTime,
+		}
+
+		if emt.Main.Name == mt.Main.Name {
+			var labels []string
+			for _, name := range names {
+				labels = append(labels, name+"="+vars[name])
+			}
+
+			emt.Main.Name = fmt.Sprintf("%s [%s]", mt.Main.Name, strings.Join(labels, " "))
+		}
+
+		for _, tk := range mt.Before {
+			emt.Before = append(emt.Before, tk.expand(vars))
+		}
+
+		for _, tk := range mt.After {
+			emt.After = append(emt.After, tk.expand(vars))
+		}
+
+		expanded = append(expanded, emt)
+	}
+
+	return expanded, nil
+}
+
+// expandMatrices returns the giving tasks with every matrix expanded, along
+// with the groups of tasks each matrix expanded into.
+func expandMatrices(tasks []*MasterTask) ([]*MasterTask, []*matrixGroup, error) {
+	var expanded []*MasterTask
+	var groups []*matrixGroup
+
+	for _, mt := range tasks {
+		mts, err := mt.ExpandMatrix()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(mt.Matrix) != 0 {
+			group := &matrixGroup{
+				name:  mt.Main.Name,
+				slots: newSemaphore(mt.MatrixParallel),
+			}
+
+			for index, emt := range mts {
+				emt.matrix = group
+				group.members = append(group.members, len(expanded)+index)
+			}
+
+			groups = append(groups, group)
+		}
+
+		expanded = append(expanded, mts...)
+	}
+
+	return expanded, groups, nil
+}
+
+// expand returns a copy of the task with the giving variables substituted and
+// set in its environment.
+func (t *Task) expand(vars map[string]string) *Task {
+	replace := matrixReplacer(vars)
+
+	tk := &Task{
+		Name:             replace(t.Name),
+		Type:             t.Type,
+		Command:          replace(t.Command),
+		Description:      replace(t.Description),
+		Interactive:      t.Interactive,
+		TTY:              t.TTY,
+		Lock:             replace(t.Lock),
+		Retries:          t.Retries,
+		RetryDelay:       t.RetryDelay,
+		RetryOnExitCodes: t.RetryOnExitCodes,
+		Timeout:          t.Timeout,
+		If:               t.If.expand(vars),
+		Input:            t.Input,
+		Terminal:         t.Terminal,
+		Env:              make(map[string]string),
+		Secrets:          t.Secrets,
+	}
+
+	for _, param := range t.Parameters {
+		tk.Parameters = append(tk.Parameters, replace(param))
+	}
+
+	for name, value := range vars {
+		tk.Env[name] = value
+	}
+
+	for name, value := range t.Env {
+		tk.Env[name] = replace(value)
+	}
+
+	return tk
+}
+
+// expand returns a copy of the condition with the giving variables substituted.
+func (c *Condition) expand(vars map[string]string) *Condition {
+	if c == nil {
+		return nil
+	}
+
+	replace := matrixReplacer(vars)
+
+	cond := &Condition{
+		Env:     replace(c.Env),
+		Exists:  replace(c.Exists),
+		Changed: replace(c.Changed),
+		Not:     c.Not,
+	}
+
+	for _, arg := range c.Command {
+		cond.Command = append(cond.Command, replace(arg))
+	}
+
+	return cond
+}
+
+// matrixReplacer returns a function replacing each ${NAME} of the giving
+// variables with its value, leaving other variables for the shell.
+func matrixReplacer(vars map[string]string) func(string) string {
+	var pairs []string
+	for name, value := range vars {
+		pairs = append(pairs, "${"+name+"}", value)
+	}
+
+	return strings.NewReplacer(pairs...).Replace
+}
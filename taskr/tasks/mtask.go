@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/influx6/faux/utils"
@@ -10,88 +11,155 @@ import (
 // MasterTask provides higher level structure which provides a series of tasks
 // which would be run in order where the main task is allowed a consistent hold on
 // the input and output writers.
-// Before and After tasks cant not down the calls, they are given a maximum of
-// 5min and then killed.
+// Every task is stopped once its timeout passes, which for Before and After
+// tasks defaults to MaxRunTime, else to the timeout of the Tson.
+// Only the main task may be interactive, Before and After tasks always have
+// their output collected by the writers.
+// If the condition of the MasterTask does not hold, all its tasks are skipped.
+// A MasterTask with a Matrix is run as one MasterTask for each combination of
+// its values, at most MatrixParallel at once if set.
+// A Service MasterTask runs a main task which keeps running until stopped, e.g
+// a server, and takes no slot of the jobs limit of its series, so services can
+// not keep other tasks from ever running.
 type MasterTask struct {
-	Main            *Task   `json:"main"`
-	MaxRunTime      string  `json:"max_runtime"`
-	MaxRunCheckTime string  `json:"max_checktime"`
-	Before          []*Task `json:"before"`
-	After           []*Task `json:"after"`
+	Main            *Task               `json:"main"`
+	Service         bool                `json:"service,omitempty"`
+	If              *Condition          `json:"if,omitempty"`
+	Matrix          map[string][]string `json:"matrix,omitempty"`
+	MatrixParallel  int                 `json:"matrix_parallel,omitempty"`
+	MaxRunTime      string              `json:"max_runtime,omitempty"`
+	MaxRunCheckTime string              `json:"max_checktime,omitempty"` // Deprecated: no longer used.
+	Before          []*Task             `json:"before,omitempty"`
+	After           []*Task             `json:"after,omitempty"`
+	timeout         time.Duration
+	matrix          *matrixGroup
+	runs            int64
 }
 
-// Stop ends all it's internal tasks.
+// Stop ends all it's internal tasks, in the reverse of the order they run, and
+// keeps a run in progress from starting its remaining tasks.
 func (mt *MasterTask) Stop(m io.Writer) {
+	atomic.AddInt64(&mt.runs, 1)
 
-	// Stop the before tasks.
-	for _, tk := range mt.Before {
-		if tk.Stopped() {
-			continue
-		}
+	tasks := mt.tasks()
+	for index := len(tasks) - 1; index >= 0; index-- {
+		tasks[index].Stop(m)
+	}
+}
+
+// Kill ends all it's internal tasks at once, in the reverse of the order they
+// run, and keeps a run in progress from starting its remaining tasks.
+func (mt *MasterTask) Kill(m io.Writer) {
+	atomic.AddInt64(&mt.runs, 1)
 
-		tk.Stop(m)
+	tasks := mt.tasks()
+	for index := len(tasks) - 1; index >= 0; index-- {
+		tasks[index].Kill(m)
 	}
+}
 
-	mt.Main.Stop(m)
+// Wait waits for all it's internal tasks to end, returning false if the giving
+// channel is closed or receives first.
+func (mt *MasterTask) Wait(abort <-chan struct{}) bool {
+	done := make(chan struct{})
 
-	// Stop the after tasks.
-	for _, tk := range mt.After {
-		if tk.Stopped() {
-			continue
+	go func() {
+		defer close(done)
+
+		for _, tk := range mt.tasks() {
+			tk.Wait()
 		}
+	}()
 
-		tk.Stop(m)
+	select {
+	case <-done:
+		return true
+	case <-abort:
+		return false
 	}
 }
 
+// tasks returns the before, main and after tasks in the order they run.
+func (mt *MasterTask) tasks() []*Task {
+	tasks := append([]*Task(nil), mt.Before...)
+	tasks = append(tasks, mt.Main)
+	return append(tasks, mt.After...)
+}
+
+// stale returns true/false if the run with the giving generation was stopped.
+func (mt *MasterTask) stale(gen int64) bool {
+	return atomic.LoadInt64(&mt.runs) != gen
+}
+
 // Run executes the givin master tasks in the other expected, passing the
 // provided writer to collect all responses.
 func (mt *MasterTask) Run(mout, merr io.Writer) error {
-	runtimes, err := utils.GetDuration(mt.MaxRunTime)
-	if err != nil {
-		return err
-	}
+	return mt.run(mout, merr, nil)
+}
 
-	checkTimes, err := utils.GetDuration(mt.MaxRunCheckTime)
+// run executes the master tasks with the giving files as the changes which
+// triggered the run, which conditions are checked against.
+func (mt *MasterTask) run(mout, merr io.Writer, changed []string) error {
+	hookTimeout, err := getDuration(mt.MaxRunTime, mt.timeout)
 	if err != nil {
 		return err
 	}
 
-	// Execute the before tasks.
-	for _, tk := range mt.Before {
-		tk.EndCheck = checkTimes
+	if mt.If != nil {
+		if ok, reason := mt.If.Check(changed); !ok {
+			for _, tk := range mt.Before {
+				tk.skip(mout, reason)
+			}
 
-		go func(tm *Task) {
-			<-time.After(runtimes)
+			mt.Main.skip(mout, reason)
 
-			if !tk.Stopped() {
-				tk.Stop(mout)
+			for _, tk := range mt.After {
+				tk.skip(mout, reason)
 			}
-		}(tk)
 
-		tk.Run(mout, merr)
+			return nil
+		}
 	}
 
-	// Set the check time.
-	mt.Main.EndCheck = checkTimes
+	gen := atomic.AddInt64(&mt.runs, 1)
+
+	// Execute the before tasks.
+	for _, tk := range mt.Before {
+		if mt.stale(gen) {
+			return nil
+		}
+
+		tk.defaultTimeout = hookTimeout
+		tk.run(mout, merr, false, changed)
+	}
+
+	if mt.stale(gen) {
+		return nil
+	}
 
 	// Execute the main tasks and allow it hold io.
-	mt.Main.Run(mout, merr)
+	mt.Main.defaultTimeout = mt.timeout
+	mt.Main.run(mout, merr, mt.Main.Interactive, changed)
 
 	// Execute the after tasks.
 	for _, tk := range mt.After {
-		tk.EndCheck = checkTimes
+		if mt.stale(gen) {
+			return nil
+		}
 
-		go func(tm *Task) {
-			<-time.After(runtimes)
+		tk.defaultTimeout = hookTimeout
+		tk.run(mout, merr, false, changed)
+	}
 
-			if !tk.Stopped() {
-				tk.Stop(mout)
-			}
-		}(tk)
+	return nil
+}
 
-		tk.Run(mout, merr)
+// getDuration returns the duration for the giving value, else returning the
+// default if the value is empty.
+func getDuration(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
 	}
 
-	return nil
+	return utils.GetDuration(value)
 }
@@ -0,0 +1,164 @@
+package tasks
+
+import "sync"
+
+// Reasons given to observers for a run of the tasks of a Tson.
+const (
+	ReasonStart    = "start"
+	ReasonFiles    = "files"
+	ReasonSchedule = "schedule"
+	ReasonRestart  = "restart"
+	ReasonReload   = "reload"
+)
+
+// Observer defines a receiver of the events of a Tson and its tasks, allowing
+// them to be followed without parsing the output written into a Sink. All
+// calls are made from the goroutines running the Tson and its tasks, so an
+// Observer must be safe for concurrent use and must not block, e.g by sending
+// events into a buffered channel and dropping those it can not keep up with.
+type Observer interface {
+	// FileChanged is called for each change of a watched file of the Tson
+	// which matches its Events, while it is not paused, with the name of the
+	// file and the change.
+	FileChanged(tson string, file string, op string)
+
+	// RestartBegan is called before the tasks of the Tson are started or
+	// restarted for the giving reason, with task set when only the main task
+	// of that name is restarted.
+	RestartBegan(tson string, task string, reason string)
+
+	// RestartEnded is called once the runs started by the matching
+	// RestartBegan are queued, their tasks reporting through TaskStarted and
+	// TaskExited as they run.
+	RestartEnded(tson string, task string, reason string)
+
+	// TaskStarted is called once the command of the named task is started.
+	TaskStarted(tson string, task string)
+
+	// TaskExited is called with the final result of each run of a task.
+	TaskExited(tson string, result TaskResult)
+
+	// Output is called with each line written by the command of the named
+	// task, unless it is attached to the terminal or runs under a
+	// pseudo-terminal, with secrets masked.
+	Output(tson string, task string, line string)
+
+	// Log is called with all output the Tson writes into its Sink.
+	Log(tson string, text string)
+}
+
+// NopObserver defines an Observer which ignores all events, for embedding into
+// observers which only handle some of them.
+type NopObserver struct{}
+
+// FileChanged implements the Observer interface.
+func (NopObserver) FileChanged(tson string, file string, op string) {}
+
+// RestartBegan implements the Observer interface.
+func (NopObserver) RestartBegan(tson string, task string, reason string) {}
+
+// RestartEnded implements the Observer interface.
+func (NopObserver) RestartEnded(tson string, task string, reason string) {}
+
+// TaskStarted implements the Observer interface.
+func (NopObserver) TaskStarted(tson string, task string) {}
+
+// TaskExited implements the Observer interface.
+func (NopObserver) TaskExited(tson string, result TaskResult) {}
+
+// Output implements the Observer interface.
+func (NopObserver) Output(tson string, task string, line string) {}
+
+// Log implements the Observer interface.
+func (NopObserver) Log(tson string, text string) {}
+
+// observerSet defines a set of registered observers.
+type observerSet struct {
+	ml        sync.Mutex
+	next      int
+	observers map[int]Observer
+}
+
+// add registers the giving observer, returning a function to remove it.
+func (obs *observerSet) add(o Observer) func() {
+	obs.ml.Lock()
+	defer obs.ml.Unlock()
+
+	if obs.observers == nil {
+		obs.observers = make(map[int]Observer)
+	}
+
+	id := obs.next
+	obs.next++
+	obs.observers[id] = o
+
+	return func() {
+		obs.ml.Lock()
+		defer obs.ml.Unlock()
+
+		delete(obs.observers, id)
+	}
+}
+
+// list returns the registered observers in the order they were added.
+func (obs *observerSet) list() []Observer {
+	if obs == nil {
+		return nil
+	}
+
+	obs.ml.Lock()
+	defer obs.ml.Unlock()
+
+	list := make([]Observer, 0, len(obs.observers))
+	for id := 0; id < obs.next; id++ {
+		if o, ok := obs.observers[id]; ok {
+			list = append(list, o)
+		}
+	}
+
+	return list
+}
+
+// Observe registers the giving observer for the events of all Tsons of the
+// series, including those added when it is reloaded, returning a function to
+// remove it.
+func (ts *TsonSeries) Observe(o Observer) func() {
+	return ts.observers.add(o)
+}
+
+// Observe registers the giving observer for the events of the Tson, returning a
+// function to remove it. Observers are kept when the Tson is replaced by a
+// reload of the series.
+func (t *Tson) Observe(o Observer) func() {
+	return t.observerSet().add(o)
+}
+
+// observerSet returns the set of observers of the Tson.
+func (t *Tson) observerSet() *observerSet {
+	t.rm.Lock()
+	defer t.rm.Unlock()
+
+	if t.observers == nil {
+		t.observers = new(observerSet)
+	}
+
+	return t.observers
+}
+
+// notify calls the giving function with each observer of the Tson and of its
+// series.
+func (t *Tson) notify(fn func(Observer)) {
+	t.rm.Lock()
+	own, series := t.observers, t.series
+	t.rm.Unlock()
+
+	for _, o := range own.list() {
+		fn(o)
+	}
+
+	if series != nil {
+		for _, o := range series.observers.list() {
+			fn(o)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package tasks_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+// eventRecorder records the events it observes as short strings.
+type eventRecorder struct {
+	ml     sync.Mutex
+	events []string
+	logs   int
+}
+
+func (er *eventRecorder) add(format string, args ...interface{}) {
+	er.ml.Lock()
+	defer er.ml.Unlock()
+
+	er.events = append(er.events, fmt.Sprintf(format, args...))
+}
+
+// list returns the recorded events starting with the giving prefix.
+func (er *eventRecorder) list(prefix string) []string {
+	er.ml.Lock()
+	defer er.ml.Unlock()
+
+	var events []string
+	for _, event := range er.events {
+		if strings.HasPrefix(event, prefix) {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+func (er *eventRecorder) FileChanged(tson string, file string, op string) {
+	er.add("file:%s:%s", tson, filepath.Base(file))
+}
+
+func (er *eventRecorder) RestartBegan(tson string, task string, reason string) {
+	er.add("began:%s:%s:%s", tson, task, reason)
+}
+
+func (er *eventRecorder) RestartEnded(tson string, task string, reason string) {
+	er.add("ended:%s:%s:%s", tson, task, reason)
+}
+
+func (er *eventRecorder) TaskStarted(tson string, task string) {
+	er.add("task:%s:%s:started", tson, task)
+}
+
+func (er *eventRecorder) TaskExited(tson string, res tasks.TaskResult) {
+	er.add("task:%s:%s:%s", tson, res.Name, res.Status)
+}
+
+func (er *eventRecorder) Output(tson string, task string, line string) {
+	er.add("task:%s:%s:output:%s", tson, task, line)
+}
+
+func (er *eventRecorder) Log(tson string, text string) {
+	er.ml.Lock()
+	defer er.ml.Unlock()
+
+	er.logs++
+}
+
+func TestTsonObservers(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	var buf syncBuffer
+
+	vet := rec.task("vet", "checked", "s3cret")
+	vet.Env = map[string]string{"TOKEN": "s3cret"}
+	vet.Secrets = []string{"TOKEN"}
+
+	tson := &tasks.Tson{
+		Name:       "build",
+		Sink:       &buf,
+		WriteDelay: "10ms",
+		Tasks: []*tasks.MasterTask{{
+			Before: []*tasks.Task{vet},
+			Main:   rec.task("compile", "built", "fail"),
+		}},
+	}
+
+	var seriesEvents, tsonEvents, removed eventRecorder
+
+	series := tasks.New(tson)
+	series.Observe(&seriesEvents)
+	tson.Observe(&tsonEvents)
+	tson.Observe(&removed)()
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	series.Wait()
+
+	want := "task:build:vet:started,task:build:vet:output:checked,task:build:vet:output:********,task:build:vet:done," +
+		"task:build:compile:started,task:build:compile:output:built,task:build:compile:failed," +
+		"began:build::start,ended:build::start"
+
+	for _, events := range []*eventRecorder{&seriesEvents, &tsonEvents} {
+		got := events.list("task:")
+		for _, prefix := range []string{"began:", "ended:"} {
+			got = append(got, events.list(prefix)...)
+		}
+
+		if strings.Join(got, ",") != want {
+			t.Fatalf("Should have observed runs of tasks: %+q", events.events)
+		}
+
+		if events.logs == 0 {
+			t.Fatalf("Should have observed logs of Tson")
+		}
+	}
+
+	if len(removed.events) != 0 || removed.logs != 0 {
+		t.Fatalf("Should not have notified removed observer: %+q", removed.events)
+	}
+}
+
+func TestTsonObserverWatchEvents(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	dir := t.TempDir()
+
+	var buf syncBuffer
+
+	series := tasks.New(&tasks.Tson{
+		Name:          "watch",
+		Sink:          &buf,
+		WriteDelay:    "10ms",
+		DebounceDelay: "10ms",
+		Files:         []string{dir},
+		Tasks:         []*tasks.MasterTask{{Main: rec.task("server", "block")}},
+	})
+
+	var events eventRecorder
+	series.Observe(&events)
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	defer func() {
+		series.Stop()
+		series.Wait()
+	}()
+
+	waitFor(t, "server to start", func() bool { return len(events.list("task:watch:server:started")) == 1 })
+
+	// Changes caught by the debounce of the watcher are dropped, so the file
+	// is written until one restarts the server.
+	waitFor(t, "restart on change", func() bool {
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644); err != nil {
+			t.Fatalf("Should have written file: %q", err.Error())
+		}
+
+		return len(events.list("ended:watch::files")) != 0
+	})
+
+	if len(events.list("file:watch:main.go")) == 0 {
+		t.Fatalf("Should have observed file change: %+q", events.events)
+	}
+	waitFor(t, "server to restart", func() bool { return len(events.list("task:watch:server:started")) >= 2 })
+
+	started := len(events.list("task:watch:server:started"))
+
+	if err := series.Restart("server"); err != nil {
+		t.Fatalf("Should have restarted task: %q", err.Error())
+	}
+
+	waitFor(t, "restart of task", func() bool {
+		return len(events.list("ended:watch:server:restart")) == 1 && len(events.list("task:watch:server:started")) > started
+	})
+
+	// Every run but the latest is stopped by the next.
+	waitFor(t, "stopped runs", func() bool {
+		return len(events.list("task:watch:server:stopped")) == len(events.list("task:watch:server:started"))-1
+	})
+}
@@ -0,0 +1,325 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stages of a MasterTask in which its tasks run, in order.
+const (
+	StageBefore = "before"
+	StageMain   = "main"
+	StageAfter  = "after"
+
+	// StageTeardown is the stage of the teardown tasks of a Tson, which run
+	// once it stops.
+	StageTeardown = "teardown"
+)
+
+// TaskPlan defines how a task would be run, with all its values resolved.
+type TaskPlan struct {
+	Step        int               `json:"step"`
+	Stage       string            `json:"stage"`
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	CommandLine string            `json:"command_line"`
+	Env         map[string]string `json:"env,omitempty"`
+	Dir         string            `json:"dir"`
+	Timeout     string            `json:"timeout,omitempty"`
+	Retries     int               `json:"retries,omitempty"`
+	Lock        string            `json:"lock,omitempty"`
+	Interactive bool              `json:"interactive,omitempty"`
+	TTY         bool              `json:"tty,omitempty"`
+	If          *Condition        `json:"if,omitempty"`
+}
+
+// MasterTaskPlan defines how a MasterTask would be run, listing its tasks in
+// the order they run.
+type MasterTaskPlan struct {
+	Name   string     `json:"name"`
+	Matrix string     `json:"matrix,omitempty"`
+	If     *Condition `json:"if,omitempty"`
+	Tasks  []TaskPlan `json:"tasks"`
+}
+
+// TsonPlan defines how a Tson would run its tasks, with its watched files
+// resolved from its globs and files as given in Globs.
+type TsonPlan struct {
+	Name        string           `json:"name"`
+	Description string           `json:"desc,omitempty"`
+	Globs       []string         `json:"globs,omitempty"`
+	Watch       []string         `json:"watch"`
+	Events      string           `json:"events,omitempty"`
+	Schedule    string           `json:"schedule,omitempty"`
+	Overlap     string           `json:"schedule_overlap,omitempty"`
+	MaxParallel int              `json:"max_parallel,omitempty"`
+	StopTimeout string           `json:"stop_timeout"`
+	Tasks       []MasterTaskPlan `json:"tasks"`
+	Teardown    []TaskPlan       `json:"teardown,omitempty"`
+}
+
+// Plan returns the plans of all Tsons in the series, without running any task.
+func (ts *TsonSeries) Plan() ([]TsonPlan, error) {
+	var plans []TsonPlan
+
+	for _, tson := range ts.Tsons() {
+		plan, err := tson.Plan()
+		if err != nil {
+			return nil, fmt.Errorf("Tson %q: %s", tson.ID(), err)
+		}
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// Plan returns how the Tson would run its tasks, validating its settings as
+// Start does without running any task.
+func (t *Tson) Plan() (TsonPlan, error) {
+	plan := TsonPlan{
+		Name:        t.ID(),
+		Description: t.Description,
+		Events:      t.Events,
+		Schedule:    t.Schedule,
+		Overlap:     t.Overlap,
+		MaxParallel: t.MaxParallel,
+		StopTimeout: t.StopTimeout,
+	}
+
+	if plan.StopTimeout == "" {
+		plan.StopTimeout = defaultStopTimeout.String()
+	}
+
+	if _, err := getDuration(plan.StopTimeout, 0); err != nil {
+		return plan, err
+	}
+
+	if t.Schedule != "" {
+		if _, err := ParseSchedule(t.Schedule); err != nil {
+			return plan, err
+		}
+
+		if plan.Overlap == "" {
+			plan.Overlap = OverlapSkip
+		}
+	}
+
+	for _, glob := range t.FilesGlob {
+		files, err := filepath.Glob(glob)
+		if err != nil {
+			return plan, err
+		}
+
+		plan.Watch = append(plan.Watch, files...)
+	}
+
+	plan.Watch = append(plan.Watch, t.Files...)
+	plan.Globs = append(append(plan.Globs, t.FilesGlob...), t.Files...)
+
+	if _, err := getDuration(t.Timeout, 0); err != nil {
+		return plan, err
+	}
+
+	planned := append([]*Task(nil), t.Teardown...)
+
+	for _, mt := range t.Tasks {
+		mts, err := mt.ExpandMatrix()
+		if err != nil {
+			return plan, err
+		}
+
+		for _, emt := range mts {
+			planned = append(planned, emt.tasks()...)
+
+			mplan, err := emt.plan(t.Timeout)
+			if err != nil {
+				return plan, err
+			}
+
+			if len(mt.Matrix) != 0 {
+				mplan.Matrix = mt.Main.Name
+			}
+
+			plan.Tasks = append(plan.Tasks, mplan)
+		}
+	}
+
+	for _, tk := range t.Teardown {
+		tplan, err := tk.plan(plan.StopTimeout)
+		if err != nil {
+			return plan, fmt.Errorf("Task %q: %s", tk.Name, err)
+		}
+
+		tplan.Step = len(plan.Teardown) + 1
+		tplan.Stage = StageTeardown
+		plan.Teardown = append(plan.Teardown, tplan)
+	}
+
+	if secrets := secretMasker(secretValues(t.Secrets, planned)); secrets != nil {
+		for index := range plan.Tasks {
+			for step := range plan.Tasks[index].Tasks {
+				plan.Tasks[index].Tasks[step].mask(secrets)
+			}
+		}
+
+		for step := range plan.Teardown {
+			plan.Teardown[step].mask(secrets)
+		}
+	}
+
+	return plan, nil
+}
+
+// mask masks the giving secrets in the command line and env of the plan.
+func (tp *TaskPlan) mask(secrets *strings.Replacer) {
+	tp.CommandLine = secrets.Replace(tp.CommandLine)
+
+	if len(tp.Env) == 0 {
+		return
+	}
+
+	env := make(map[string]string)
+	for name, value := range tp.Env {
+		env[name] = secrets.Replace(value)
+	}
+
+	tp.Env = env
+}
+
+// plan returns how the MasterTask would run its tasks, with the giving timeout
+// of its Tson.
+func (mt *MasterTask) plan(tsonTimeout string) (MasterTaskPlan, error) {
+	plan := MasterTaskPlan{If: mt.If}
+	if mt.Main != nil {
+		plan.Name = mt.Main.Name
+	}
+
+	hookTimeout := mt.MaxRunTime
+	if hookTimeout == "" {
+		hookTimeout = tsonTimeout
+	}
+
+	if _, err := getDuration(hookTimeout, 0); err != nil {
+		return plan, err
+	}
+
+	add := func(stage string, tk *Task, timeout string) error {
+		tplan, err := tk.plan(timeout)
+		if err != nil {
+			return fmt.Errorf("Task %q: %s", tk.Name, err)
+		}
+
+		tplan.Step = len(plan.Tasks) + 1
+		tplan.Stage = stage
+		plan.Tasks = append(plan.Tasks, tplan)
+		return nil
+	}
+
+	for _, tk := range mt.Before {
+		if err := add(StageBefore, tk, hookTimeout); err != nil {
+			return plan, err
+		}
+	}
+
+	if mt.Main == nil {
+		return plan, fmt.Errorf("MasterTask has no main task")
+	}
+
+	if err := add(StageMain, mt.Main, tsonTimeout); err != nil {
+		return plan, err
+	}
+
+	for _, tk := range mt.After {
+		if err := add(StageAfter, tk, hookTimeout); err != nil {
+			return plan, err
+		}
+	}
+
+	return plan, nil
+}
+
+// plan returns how the task would be run, using the giving timeout if the
+// task sets none.
+func (t *Task) plan(defaultTimeout string) (TaskPlan, error) {
+	plan := TaskPlan{
+		Name:        t.Name,
+		Type:        t.Type,
+		Env:         t.Env,
+		Timeout:     t.Timeout,
+		Retries:     t.Retries,
+		Lock:        t.Lock,
+		Interactive: t.Interactive,
+		TTY:         t.TTY,
+		If:          t.If,
+	}
+
+	if plan.Type == "" {
+		plan.Type = TypeExec
+	}
+
+	if plan.Timeout == "" {
+		plan.Timeout = defaultTimeout
+	}
+
+	if _, err := getDuration(plan.Timeout, 0); err != nil {
+		return plan, err
+	}
+
+	if _, err := getDuration(t.RetryDelay, 0); err != nil {
+		return plan, err
+	}
+
+	if _, err := newExecutor(t); err != nil {
+		return plan, err
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Dir = dir
+
+	args := t.Parameters
+	if plan.Type == TypeExec {
+		args = append([]string{t.Command}, args...)
+	} else {
+		args = append([]string{plan.Type}, args...)
+	}
+
+	plan.CommandLine = commandLine(args)
+
+	return plan, nil
+}
+
+// commandLine returns the giving arguments joined as a shell command line,
+// quoting those which would otherwise be split or expanded.
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+
+	for index, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;#~") {
+			arg = strconv.Quote(arg)
+		}
+
+		quoted[index] = arg
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// EnvList returns the giving environment as NAME=value pairs ordered by name.
+func EnvList(env map[string]string) []string {
+	var pairs []string
+	for name, value := range env {
+		pairs = append(pairs, name+"="+value)
+	}
+
+	sort.Strings(pairs)
+	return pairs
+}
@@ -0,0 +1,143 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ptySupported is true as pseudo-terminals are supported.
+const ptySupported = true
+
+// winsize defines the terminal size structure used by the TIOCGWINSZ and
+// TIOCSWINSZ ioctls.
+type winsize struct {
+	Rows   uint16
+	Cols   uint16
+	XPixel uint16
+	YPixel uint16
+}
+
+// openPTY returns a new pseudo-terminal pair, where the master is read by taskr
+// and the slave is handed to the command as its terminal.
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	var ptn uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&ptn))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", ptn), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+// ptyAttrs returns the process attributes which make the pty the controlling
+// terminal of the command started with it as its standard input.
+func ptyAttrs() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true, Setctty: true}
+}
+
+// copyWinsize sets the size of the pty to that of the terminal, if taskr
+// itself is attached to one.
+func copyWinsize(pty *os.File) error {
+	var ws winsize
+	if err := ioctl(os.Stdout.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return err
+	}
+
+	return ioctl(pty.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
+
+// watchWinsize keeps the pty size in sync with the terminal until the
+// returned function is called.
+func watchWinsize(pty *os.File) func() {
+	resized := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(resized, syscall.SIGWINCH)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-resized:
+				copyWinsize(pty)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(resized)
+		close(done)
+	}
+}
+
+// makeRaw puts the terminal behind the giving file into raw mode, returning a
+// function to restore its previous state. It does nothing if the file is not
+// a terminal.
+func makeRaw(fl *os.File) func() {
+	var old syscall.Termios
+	if err := ioctl(fl.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&old))); err != nil {
+		return func() {}
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(fl.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&raw))); err != nil {
+		return func() {}
+	}
+
+	return func() {
+		ioctl(fl.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&old)))
+	}
+}
+
+// waitInput returns true once the giving file descriptor has input to read,
+// else false if none arrives within the giving timeout.
+func waitInput(fd uintptr, timeout time.Duration) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+
+	n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+	if err == unix.EINTR {
+		return false, nil
+	}
+
+	return n > 0, err
+}
+
+func ioctl(fd uintptr, req uintptr, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+//go:build !linux
+// +build !linux
+
+package tasks
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ptySupported is false as pseudo-terminals are not supported.
+const ptySupported = false
+
+// ErrNoPTY is returned when pseudo-terminals are not supported on the platform.
+var ErrNoPTY = errors.New("Pseudo-terminals are only supported on linux")
+
+// openPTY returns ErrNoPTY as pseudo-terminals are not supported.
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, ErrNoPTY
+}
+
+// ptyAttrs returns no process attributes.
+func ptyAttrs() *syscall.SysProcAttr {
+	return nil
+}
+
+// copyWinsize does nothing on platforms without pseudo-terminals.
+func copyWinsize(pty *os.File) error {
+	return ErrNoPTY
+}
+
+// watchWinsize does nothing on platforms without pseudo-terminals.
+func watchWinsize(pty *os.File) func() {
+	return func() {}
+}
+
+// makeRaw does nothing on platforms without pseudo-terminals.
+func makeRaw(fl *os.File) func() {
+	return func() {}
+}
+
+// waitInput does nothing on platforms without pseudo-terminals.
+func waitInput(fd uintptr, timeout time.Duration) (bool, error) {
+	return false, ErrNoPTY
+}
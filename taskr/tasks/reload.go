@@ -0,0 +1,274 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ReloadResult defines what a reload of a series changed, naming the Tsons
+// started, restarted and stopped, and the main tasks of MasterTasks restarted
+// within Tsons which were otherwise left running.
+type ReloadResult struct {
+	Started   []string `json:"started,omitempty"`
+	Restarted []string `json:"restarted,omitempty"`
+	Stopped   []string `json:"stopped,omitempty"`
+	Tasks     []string `json:"tasks,omitempty"`
+}
+
+// Changed returns true/false if the reload changed anything.
+func (rr ReloadResult) Changed() bool {
+	return len(rr.Started)+len(rr.Restarted)+len(rr.Stopped)+len(rr.Tasks) != 0
+}
+
+// String returns the changes of the reload.
+func (rr ReloadResult) String() string {
+	if !rr.Changed() {
+		return "no changes"
+	}
+
+	var changes []string
+
+	add := func(action string, names []string) {
+		if len(names) != 0 {
+			changes = append(changes, fmt.Sprintf("%s %q", action, names))
+		}
+	}
+
+	add("started", rr.Started)
+	add("restarted", rr.Restarted)
+	add("stopped", rr.Stopped)
+	add("restarted tasks", rr.Tasks)
+
+	return strings.Join(changes, ", ")
+}
+
+// Reload replaces the Tsons of the running series with the giving Tsons,
+// leaving those whose definition did not change running. Tsons are matched by
+// name: new Tsons are started, removed ones stopped and changed ones restarted,
+// except that when only some MasterTasks of a Tson without a matrix changed,
+// just those MasterTasks are restarted. The giving Tsons are validated first,
+// leaving the series untouched if any is invalid. If a Tson fails to start,
+// the Tsons started so far and those not yet reached are kept in the series,
+// so all running Tsons are still stopped with it. A series which is stopping
+// is not reloaded.
+func (ts *TsonSeries) Reload(tsons []*Tson) (ReloadResult, error) {
+	ts.reload.Lock()
+	defer ts.reload.Unlock()
+
+	var result ReloadResult
+
+	if ts.stopping {
+		return result, ErrStopping
+	}
+
+	// Keep Wait from returning while a Tson is restarted.
+	ts.wg.Add(1)
+	defer ts.wg.Done()
+
+	if err := validateTsons(tsons); err != nil {
+		return result, err
+	}
+
+	previous := ts.Tsons()
+
+	current := make(map[string]*Tson)
+	for _, tson := range previous {
+		current[tson.ID()] = tson
+	}
+
+	var next []*Tson
+	stopped := make(map[*Tson]bool)
+
+	// The series is left with the Tsons running once the reload ends, keeping
+	// those it did not get to when it fails.
+	defer func() {
+		kept := make(map[*Tson]bool)
+		for _, tson := range next {
+			kept[tson] = true
+		}
+
+		for _, prev := range previous {
+			if !kept[prev] && !stopped[prev] {
+				next = append(next, prev)
+			}
+		}
+
+		ts.ml.Lock()
+		ts.Tasks = next
+		ts.ml.Unlock()
+	}()
+
+	for _, tson := range tsons {
+		prev, ok := current[tson.ID()]
+		delete(current, tson.ID())
+
+		if !ok {
+			if err := ts.start(tson); err != nil {
+				return result, err
+			}
+
+			result.Started = append(result.Started, tson.ID())
+			next = append(next, tson)
+			continue
+		}
+
+		if tson.Sink == nil {
+			tson.Sink = prev.Sink
+		}
+
+		if tson.Stats == nil {
+			tson.Stats = prev.Stats
+		}
+
+		tson.rm.Lock()
+		tson.observers = prev.observerSet()
+		tson.rm.Unlock()
+
+		if !sameSettings(prev, tson) || !prev.reloadTasks(tson.Tasks, &result) {
+			prev.Stop()
+			prev.Wait()
+			stopped[prev] = true
+
+			if err := ts.start(tson); err != nil {
+				return result, err
+			}
+
+			result.Restarted = append(result.Restarted, tson.ID())
+			next = append(next, tson)
+			continue
+		}
+
+		next = append(next, prev)
+	}
+
+	for _, prev := range previous {
+		if _, ok := current[prev.ID()]; ok {
+			prev.Stop()
+			prev.Wait()
+			stopped[prev] = true
+			result.Stopped = append(result.Stopped, prev.ID())
+		}
+	}
+
+	return result, nil
+}
+
+// validateTsons returns an error if the giving Tsons could not be started.
+func validateTsons(tsons []*Tson) error {
+	names := make(map[string]bool)
+
+	for _, tson := range tsons {
+		if names[tson.ID()] {
+			return fmt.Errorf("Tson %q is defined more than once", tson.ID())
+		}
+
+		names[tson.ID()] = true
+
+		if _, err := tson.Plan(); err != nil {
+			return fmt.Errorf("Tson %q: %s", tson.ID(), err)
+		}
+	}
+
+	if interactiveMains(tsons) > 1 {
+		return ErrManyInteractive
+	}
+
+	return nil
+}
+
+// sameSettings returns true/false if the giving Tsons are defined the same,
+// leaving out their tasks.
+func sameSettings(a, b *Tson) bool {
+	settings := func(t *Tson) []byte {
+		data, _ := json.Marshal(struct {
+			*Tson
+			Tasks []*MasterTask `json:"tasks,omitempty"`
+		}{Tson: t})
+
+		return data
+	}
+
+	return bytes.Equal(settings(a), settings(b))
+}
+
+// sameDefinition returns true/false if the giving MasterTasks are defined the
+// same.
+func sameDefinition(a, b *MasterTask) bool {
+	da, _ := json.Marshal(a)
+	db, _ := json.Marshal(b)
+
+	return bytes.Equal(da, db)
+}
+
+// reloadTasks restarts the MasterTasks of the running Tson whose definition
+// differs from the giving MasterTasks with the giving ones, adding their names
+// to the result. It returns false if the MasterTasks can not be replaced one by
+// one, as they differ in number, use a matrix or the Tson has ended, in which
+// case the Tson must be restarted instead.
+func (t *Tson) reloadTasks(mts []*MasterTask, result *ReloadResult) bool {
+	if len(mts) != len(t.defined) {
+		return false
+	}
+
+	changed := make(map[int]*MasterTask)
+
+	for index, mt := range mts {
+		if len(mt.Matrix) != 0 || len(t.defined[index].Matrix) != 0 {
+			return false
+		}
+
+		if !sameDefinition(t.defined[index], mt) {
+			changed[index] = mt
+		}
+	}
+
+	if len(changed) == 0 {
+		return true
+	}
+
+	// The secrets masked in the output of the Tson can only change with it.
+	next := &Tson{Tasks: mts, Teardown: t.Teardown}
+	if strings.Join(secretValues(t.Secrets, next.allTasks()), "\x00") != strings.Join(t.masked, "\x00") {
+		return false
+	}
+
+	select {
+	case t.taskReloader <- changed:
+	case <-t.ended:
+		return false
+	}
+
+	for index, mt := range mts {
+		if changed[index] == mt {
+			t.defined[index] = mt
+			result.Tasks = append(result.Tasks, t.ID()+"/"+mt.Main.Name)
+		}
+	}
+
+	return true
+}
+
+// reloadTask stops the MasterTask at the giving index and runs the giving
+// MasterTask in its place.
+func (t *Tson) reloadTask(index int, mt *MasterTask) {
+	t.writeLog(bytes.NewBufferString(fmt.Sprintf("TSON Reload: restarting %q\n", mt.Main.Name)))
+
+	name := mt.Main.Name
+	t.notify(func(o Observer) { o.RestartBegan(t.ID(), name, ReasonReload) })
+	defer t.notify(func(o Observer) { o.RestartEnded(t.ID(), name, ReasonReload) })
+
+	t.Tasks[index].Stop(t.twriters.Writer(index))
+
+	mt.timeout = t.timeout
+	for _, tk := range mt.tasks() {
+		t.prepareTask(tk)
+	}
+
+	t.rm.Lock()
+	t.Tasks[index] = mt
+	t.rm.Unlock()
+
+	t.runTask(index, nil)
+}
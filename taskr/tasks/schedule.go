@@ -0,0 +1,214 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Overlap policies which decide what a scheduled Tson does when its schedule
+// fires while its tasks are still running.
+const (
+	OverlapSkip    = "skip"
+	OverlapQueue   = "queue"
+	OverlapRestart = "restart"
+)
+
+// Schedule defines an interface for types which provide the next time a
+// scheduled run should occur.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// scheduleDescriptors maps the supported @ descriptors to their cron expression.
+var scheduleDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule returns a Schedule for the giving spec, which is either a
+// standard five field cron expression (minute, hour, day of month, month, day
+// of week), a descriptor like @daily or @hourly, or an interval like @every 5m.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, err
+		}
+
+		if every <= 0 {
+			return nil, errors.New("Schedule interval must be positive")
+		}
+
+		return everySchedule(every), nil
+	}
+
+	if expr, ok := scheduleDescriptors[spec]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Schedule %q must have 5 fields: minute hour day-of-month month day-of-week", spec)
+	}
+
+	var cron cronSchedule
+	var err error
+
+	if cron.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+
+	if cron.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+
+	if cron.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+
+	if cron.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+
+	if cron.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+
+	// Sunday can be given as either 0 or 7.
+	if cron.dow&(1<<7) != 0 {
+		cron.dow |= 1
+	}
+
+	cron.anyDom = fields[2] == "*"
+	cron.anyDow = fields[4] == "*"
+
+	return &cron, nil
+}
+
+// everySchedule runs at a fixed interval from the last run.
+type everySchedule time.Duration
+
+// Next returns the giving time added with the interval.
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cronSchedule runs at the times matched by a cron expression, with each
+// field held as a set of bits for the values it matches.
+type cronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+}
+
+// Next returns the first time after the giving time which matches the cron
+// expression, or the zero time if none exists within five years.
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// matchDay returns true/false if the day of the giving time matches, where
+// like cron, a day matches either field if both day fields are restricted.
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dowMatch
+	case c.anyDow:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// parseCronField returns the set of values matched by a cron field within the
+// giving bounds, supporting lists, ranges and steps (e.g 1,5-10,*/15).
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		low, high := min, max
+
+		if index := strings.Index(part, "/"); index != -1 {
+			value, err := strconv.Atoi(part[index+1:])
+			if err != nil || value <= 0 {
+				return 0, fmt.Errorf("Invalid step in schedule field %q", field)
+			}
+
+			step = value
+			part = part[:index]
+		}
+
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("Invalid range in schedule field %q", field)
+			}
+
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("Invalid range in schedule field %q", field)
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("Invalid value in schedule field %q", field)
+			}
+
+			low = value
+			if step == 1 {
+				high = value
+			}
+		}
+
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("Schedule field %q must be within %d-%d", field, min, max)
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
@@ -0,0 +1,83 @@
+package tasks_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2017, time.March, 10, 10, 7, 30, 0, time.UTC) // A Friday.
+
+	specs := []struct {
+		spec string
+		next time.Time
+	}{
+		{"@every 5m", from.Add(5 * time.Minute)},
+		{"* * * * *", time.Date(2017, time.March, 10, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2017, time.March, 10, 10, 15, 0, 0, time.UTC)},
+		{"30 9-17 * * *", time.Date(2017, time.March, 10, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * 0", time.Date(2017, time.March, 12, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2017, time.March, 12, 3, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2017, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * 1", time.Date(2017, time.March, 13, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2017, time.March, 11, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, sp := range specs {
+		schedule, err := tasks.ParseSchedule(sp.spec)
+		if err != nil {
+			t.Fatalf("\tFailed: \t Should have parsed schedule %q: %q", sp.spec, err.Error())
+		}
+
+		if next := schedule.Next(from); !next.Equal(sp.next) {
+			t.Fatalf("\tFailed: \t Schedule %q should run next at %s not %s", sp.spec, sp.next, next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "@every -5m", "@often"} {
+		if _, err := tasks.ParseSchedule(spec); err == nil {
+			t.Fatalf("\tFailed: \t Should have rejected schedule %q", spec)
+		}
+	}
+}
+
+func TestScheduledTson(t *testing.T) {
+	var buf bytes.Buffer
+	var tson tasks.Tson
+
+	tson.Sink = &buf
+	tson.Name = "scheduled"
+	tson.WriteDelay = "10ms"
+	tson.Schedule = "@every 100ms"
+	tson.Tasks = []*tasks.MasterTask{
+		{
+			Main: &tasks.Task{
+				Name:    "Echo",
+				Command: "echo",
+			},
+		},
+	}
+
+	if err := tson.Start(); err != nil {
+		t.Fatalf("\tFailed: \t Error occurred in start tson: %q", err.Error())
+	}
+
+	<-time.After(50 * time.Millisecond)
+
+	if res := tson.Tasks[0].Main.Result(); res.Status != tasks.StatusPending {
+		t.Fatalf("Should not have run before schedule fired: %+v", res)
+	}
+
+	<-time.After(300 * time.Millisecond)
+
+	tson.Stop()
+	tson.Wait()
+
+	if runs := len(tson.Tasks[0].Main.History()); runs < 2 {
+		t.Fatalf("Should have run main task on schedule at least twice: %d", runs)
+	}
+}
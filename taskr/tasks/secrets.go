@@ -0,0 +1,254 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// secretMask replaces the value of a secret wherever it is written.
+const secretMask = "********"
+
+// envVar defines an env entry of a task given as an object, allowing its value
+// to be marked as a secret.
+type envVar struct {
+	Value  string `json:"value"`
+	Secret bool   `json:"secret"`
+}
+
+// UnmarshalJSON decodes the task, accepting env entries given either as their
+// value or as an object holding their value which may be marked as a secret,
+// e.g {"value": "...", "secret": true}, adding their name to the secrets of the
+// task.
+func (t *Task) UnmarshalJSON(data []byte) error {
+	type task Task
+
+	decoded := struct {
+		*task
+		Env map[string]json.RawMessage `json:"env,omitempty"`
+	}{task: (*task)(t)}
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	if decoded.Env == nil {
+		return nil
+	}
+
+	t.Env = make(map[string]string)
+
+	for name, raw := range decoded.Env {
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			var ev envVar
+			if err := json.Unmarshal(raw, &ev); err != nil {
+				return err
+			}
+
+			t.Env[name] = ev.Value
+
+			if ev.Secret && !hasName(t.Secrets, name) {
+				t.Secrets = append(t.Secrets, name)
+			}
+
+			continue
+		}
+
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+
+		t.Env[name] = value
+	}
+
+	sort.Strings(t.Secrets)
+	return nil
+}
+
+// hasName returns true/false if the giving names contain the name.
+func hasName(names []string, name string) bool {
+	for _, item := range names {
+		if item == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// secretValues returns the values of the env vars named by the giving secrets
+// or by the secrets of the giving tasks, taken from the env of the tasks or else
+// from the environment of taskr, longest first.
+func secretValues(secrets []string, tasks []*Task) []string {
+	seen := make(map[string]bool)
+	var values []string
+
+	add := func(value string) {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+
+	for _, name := range secrets {
+		add(os.Getenv(name))
+
+		for _, tk := range tasks {
+			add(tk.Env[name])
+		}
+	}
+
+	for _, tk := range tasks {
+		for _, name := range tk.Secrets {
+			if value, ok := tk.Env[name]; ok {
+				add(value)
+			} else {
+				add(os.Getenv(name))
+			}
+		}
+	}
+
+	// Longer secrets come first, so a secret holding another is masked whole.
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+
+		return values[i] < values[j]
+	})
+
+	return values
+}
+
+// secretMasker returns a replacer masking the giving secret values, else nil if
+// there are none.
+func secretMasker(values []string) *strings.Replacer {
+	if len(values) == 0 {
+		return nil
+	}
+
+	var pairs []string
+	for _, value := range values {
+		pairs = append(pairs, value, secretMask)
+	}
+
+	return strings.NewReplacer(pairs...)
+}
+
+// maskSecrets returns the giving text with the secrets of the giving replacer
+// masked.
+func maskSecrets(secrets *strings.Replacer, text string) string {
+	if secrets == nil {
+		return text
+	}
+
+	return secrets.Replace(text)
+}
+
+// maskWriter defines a writer which masks secrets in all it writes into its
+// underline writer. The end of a write which may be the start of a secret is
+// held back until the next write, so a secret split across writes, e.g across
+// reads of a pseudo-terminal, is still masked. Flush writes what is held back
+// once no more writes follow.
+type maskWriter struct {
+	ml      sync.Mutex
+	w       io.Writer
+	values  []string
+	secrets *strings.Replacer
+	held    string
+}
+
+// newMaskWriter returns a new maskWriter masking the giving secret values in
+// all it writes into the giving writer.
+func newMaskWriter(w io.Writer, values []string) *maskWriter {
+	return &maskWriter{w: w, values: values, secrets: secretMasker(values)}
+}
+
+// Write writes the giving bytes with their secrets masked, holding back any
+// end which may be the start of a secret.
+func (mw *maskWriter) Write(bu []byte) (int, error) {
+	mw.ml.Lock()
+	defer mw.ml.Unlock()
+
+	text := mw.held + string(bu)
+	cut := secretCut(text, mw.values)
+	mw.held = text[cut:]
+
+	if cut == 0 {
+		return len(bu), nil
+	}
+
+	if _, err := mw.w.Write([]byte(maskSecrets(mw.secrets, text[:cut]))); err != nil {
+		return 0, err
+	}
+
+	return len(bu), nil
+}
+
+// Flush writes what is held back with its secrets masked.
+func (mw *maskWriter) Flush() {
+	mw.ml.Lock()
+	defer mw.ml.Unlock()
+
+	if mw.held != "" {
+		mw.w.Write([]byte(maskSecrets(mw.secrets, mw.held)))
+		mw.held = ""
+	}
+}
+
+// secretCut returns the index of the giving text before which its secrets can
+// be masked, leaving after it an end which is the start of a secret, or a
+// secret which would otherwise be cut.
+func secretCut(text string, values []string) int {
+	cut := len(text)
+
+	for _, value := range values {
+		for size := len(value) - 1; size > 0; size-- {
+			if len(text)-size < cut && strings.HasSuffix(text, value[:size]) {
+				cut = len(text) - size
+				break
+			}
+		}
+	}
+
+	for moved := true; moved; {
+		moved = false
+
+		for _, value := range values {
+			for start := 0; start < cut; start++ {
+				index := strings.Index(text[start:], value)
+				if index == -1 {
+					break
+				}
+
+				start += index
+				if start < cut && start+len(value) > cut {
+					cut = start
+					moved = true
+				}
+			}
+		}
+	}
+
+	return cut
+}
+
+// allTasks returns the tasks of the Tson's MasterTasks and its teardown tasks.
+func (t *Tson) allTasks() []*Task {
+	var tasks []*Task
+
+	for _, mt := range t.Tasks {
+		for _, tk := range mt.tasks() {
+			if tk != nil {
+				tasks = append(tasks, tk)
+			}
+		}
+	}
+
+	return append(tasks, t.Teardown...)
+}
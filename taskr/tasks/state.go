@@ -0,0 +1,160 @@
+package tasks
+
+import (
+	"sync"
+	"time"
+)
+
+// TaskState defines a state in the lifecycle of a Task.
+type TaskState string
+
+// States which a task moves through. A task is pending until it first runs,
+// starting while its command is being started, running until it exits or is
+// asked to stop, stopping until it exits once asked, and then exited, or failed
+// if it could not start, exited with a failure or timed out. Skipped and
+// stopped runs end as exited.
+const (
+	StatePending  TaskState = "pending"
+	StateStarting TaskState = "starting"
+	StateRunning  TaskState = "running"
+	StateStopping TaskState = "stopping"
+	StateExited   TaskState = "exited"
+	StateFailed   TaskState = "failed"
+)
+
+// transitions holds the states each state can move to. A task can start again
+// while stopping, as a restart starts a new run before the stopped one exits,
+// and be stopped while failed, when it waits to retry.
+var transitions = map[TaskState][]TaskState{
+	StatePending:  {StateStarting, StateExited, StateFailed},
+	StateStarting: {StateRunning, StateStopping, StateExited, StateFailed},
+	StateRunning:  {StateStopping, StateExited, StateFailed},
+	StateStopping: {StateStarting, StateExited, StateFailed},
+	StateExited:   {StateStarting, StateFailed},
+	StateFailed:   {StateStarting, StateStopping, StateExited},
+}
+
+// CanMove returns true/false if a task in the state can move to the giving
+// state.
+func (ts TaskState) CanMove(to TaskState) bool {
+	for _, next := range transitions[ts] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Ended returns true/false if the state is one a task is left in once a run
+// has ended.
+func (ts TaskState) Ended() bool {
+	return ts == StateExited || ts == StateFailed
+}
+
+// StateChange defines a move of the named task from one state to another.
+type StateChange struct {
+	Task string    `json:"task"`
+	From TaskState `json:"from"`
+	To   TaskState `json:"to"`
+	Time time.Time `json:"time"`
+}
+
+// stateBuffer sets the number of pending changes a subscriber may have before
+// further changes are dropped for it.
+const stateBuffer = 64
+
+// stateFeed defines a broadcaster of state changes to subscribers, which never
+// blocks, a subscriber which falls behind misses changes instead.
+type stateFeed struct {
+	ml   sync.Mutex
+	subs map[chan StateChange]struct{}
+}
+
+// subscribe returns a channel which receives all state changes and a function
+// to end the subscription, which closes the channel.
+func (sf *stateFeed) subscribe() (<-chan StateChange, func()) {
+	sub := make(chan StateChange, stateBuffer)
+
+	sf.ml.Lock()
+	if sf.subs == nil {
+		sf.subs = make(map[chan StateChange]struct{})
+	}
+	sf.subs[sub] = struct{}{}
+	sf.ml.Unlock()
+
+	var once sync.Once
+
+	return sub, func() {
+		once.Do(func() {
+			sf.ml.Lock()
+			delete(sf.subs, sub)
+			sf.ml.Unlock()
+
+			close(sub)
+		})
+	}
+}
+
+// publish sends the giving change to all subscribers.
+func (sf *stateFeed) publish(change StateChange) {
+	sf.ml.Lock()
+	defer sf.ml.Unlock()
+
+	for sub := range sf.subs {
+		select {
+		case sub <- change:
+		default:
+		}
+	}
+}
+
+// State returns the current state of the task.
+func (t *Task) State() TaskState {
+	t.rl.Lock()
+	defer t.rl.Unlock()
+
+	return t.currentState()
+}
+
+// Subscribe returns a channel which receives every change of the task's state
+// in order, and a function to end the subscription. Changes are dropped for a
+// subscriber which does not keep up rather than holding the task back.
+func (t *Task) Subscribe() (<-chan StateChange, func()) {
+	return t.states.subscribe()
+}
+
+// currentState returns the state of the task, it must be called with the lock
+// held.
+func (t *Task) currentState() TaskState {
+	if t.state == "" {
+		return StatePending
+	}
+
+	return t.state
+}
+
+// moveTo moves the task to the giving state if it can move there from its
+// current state, notifying subscribers, and returns true/false if it moved. It
+// must be called with the lock held.
+func (t *Task) moveTo(to TaskState) bool {
+	from := t.currentState()
+	if !from.CanMove(to) {
+		return false
+	}
+
+	t.state = to
+	t.states.publish(StateChange{Task: t.Name, From: from, To: to, Time: time.Now()})
+
+	return true
+}
+
+// endState returns the state a run with the giving result ends in.
+func endState(res TaskResult) TaskState {
+	switch res.Status {
+	case StatusFailed, StatusTimedOut:
+		return StateFailed
+	default:
+		return StateExited
+	}
+}
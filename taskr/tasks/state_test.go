@@ -0,0 +1,142 @@
+package tasks_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+// collectStates returns a function returning the moves of the subscribed
+// task so far, as from>to pairs.
+func collectStates(t *testing.T, changes <-chan tasks.StateChange) func() []string {
+	var ml sync.Mutex
+	var moves []string
+
+	go func() {
+		for change := range changes {
+			if !change.From.CanMove(change.To) {
+				t.Errorf("Should not have moved from %s to %s", change.From, change.To)
+			}
+
+			ml.Lock()
+			moves = append(moves, string(change.From)+">"+string(change.To))
+			ml.Unlock()
+		}
+	}()
+
+	return func() []string {
+		ml.Lock()
+		defer ml.Unlock()
+
+		return append([]string(nil), moves...)
+	}
+}
+
+func TestTaskStates(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	var buf syncBuffer
+
+	failing := rec.task("Failing", "fail")
+	failing.Retries = 1
+	failing.RetryDelay = "1ms"
+
+	if failing.Stopped() || failing.State() != tasks.StatePending {
+		t.Fatalf("Should be pending before running: %s", failing.State())
+	}
+
+	changes, unsubscribe := failing.Subscribe()
+	moves := collectStates(t, changes)
+
+	failing.Run(&buf, &buf)
+
+	want := "pending>starting,starting>running,running>failed,failed>starting,starting>running,running>failed"
+	waitFor(t, "failed moves", func() bool { return strings.Join(moves(), ",") == want })
+
+	if !failing.Stopped() || failing.State() != tasks.StateFailed {
+		t.Fatalf("Should have ended failed: %s", failing.State())
+	}
+
+	unsubscribe()
+
+	blocking := rec.task("Blocking", "block")
+	changes, unsubscribe = blocking.Subscribe()
+	defer unsubscribe()
+
+	moves = collectStates(t, changes)
+
+	go blocking.Run(&buf, &buf)
+
+	waitFor(t, "task to run", func() bool { return blocking.State() == tasks.StateRunning })
+
+	blocking.Stop(&buf)
+	blocking.Wait()
+
+	want = "pending>starting,starting>running,running>stopping,stopping>exited"
+	waitFor(t, "stopped moves", func() bool { return strings.Join(moves(), ",") == want })
+
+	if res := blocking.Result(); res.Status != tasks.StatusStopped && res.Status != tasks.StatusFailed {
+		t.Fatalf("Should have stopped task: %+v", res)
+	}
+}
+
+func TestTsonConcurrentRestarts(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	var buf syncBuffer
+
+	tson := &tasks.Tson{
+		Name:       "restarts",
+		Sink:       &buf,
+		WriteDelay: "1ms",
+		Tasks: []*tasks.MasterTask{
+			{Before: []*tasks.Task{rec.task("Prepare")}, Main: rec.task("Server", "block")},
+			{Main: rec.task("Worker", "block")},
+		},
+	}
+
+	changes, unsubscribe := tson.Tasks[0].Main.Subscribe()
+	defer unsubscribe()
+
+	collectStates(t, changes)
+
+	series := tasks.New(tson)
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			for index := 0; index < 10; index++ {
+				switch (worker + index) % 3 {
+				case 0:
+					tson.Restart()
+				case 1:
+					tson.RestartTask("Server")
+				default:
+					series.Status()
+				}
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+
+	server := tson.Tasks[0].Main
+	waitFor(t, "server to run", func() bool { return server.State() == tasks.StateRunning })
+
+	series.Stop()
+	series.Wait()
+
+	if state := server.State(); !state.Ended() {
+		t.Fatalf("Should have ended server: %s", state)
+	}
+}
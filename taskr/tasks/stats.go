@@ -0,0 +1,262 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// trendRuns sets how many of the latest runs of a task are compared with the
+// runs before them to find the trend of its wall time.
+const trendRuns = 5
+
+// StatRecord defines the result of a run of a task of the named Tson, as kept
+// in a stats file.
+type StatRecord struct {
+	Tson string `json:"tson"`
+	TaskResult
+}
+
+// StatsLog defines a file which the results of tasks are appended to as lines
+// of json, keeping their history across runs of taskr.
+type StatsLog struct {
+	Path string
+	ml   sync.Mutex
+}
+
+// NewStatsLog returns a new StatsLog writing into the file at the giving path.
+func NewStatsLog(path string) *StatsLog {
+	return &StatsLog{Path: path}
+}
+
+// Record appends the result of a run of a task of the named Tson to the file.
+func (sl *StatsLog) Record(tson string, res TaskResult) error {
+	data, err := json.Marshal(StatRecord{Tson: tson, TaskResult: res})
+	if err != nil {
+		return err
+	}
+
+	sl.ml.Lock()
+	defer sl.ml.Unlock()
+
+	file, err := os.OpenFile(sl.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Trim drops all but the giving number of latest records from the file, when
+// it holds more. The kept records are written to a new file which replaces it,
+// so the records are not lost if taskr dies while trimming.
+func (sl *StatsLog) Trim(keep int) error {
+	sl.ml.Lock()
+	defer sl.ml.Unlock()
+
+	records, err := ReadStats(sl.Path)
+	if err != nil || len(records) <= keep {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records[len(records)-keep:] {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(append(data, '\n'))
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(sl.Path), filepath.Base(sl.Path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), sl.Path)
+}
+
+// ReadStats returns the records of the stats file at the giving path, oldest
+// first. Lines which are not records, e.g one cut short by a crash, are
+// skipped. A missing file has no records.
+func ReadStats(path string) ([]StatRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var records []StatRecord
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		var record StatRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// TaskStats defines the usage of a task summarised across its recorded runs.
+// Times are averaged over the runs which ended on their own, leaving out those
+// stopped or restarted, while the peak memory covers all runs. Trend is the
+// change of the average wall time of the latest runs over the runs before
+// them, e.g 0.25 when they took a quarter longer, and 0 until there are enough
+// runs to compare.
+type TaskStats struct {
+	Tson    string        `json:"tson"`
+	Task    string        `json:"task"`
+	Runs    int           `json:"runs"`
+	Failed  int           `json:"failed"`
+	Last    time.Time     `json:"last"`
+	Wall    time.Duration `json:"avg_wall"`
+	MaxWall time.Duration `json:"max_wall"`
+	User    time.Duration `json:"avg_user"`
+	System  time.Duration `json:"avg_system"`
+	PeakRSS int64         `json:"peak_rss"`
+	Trend   float64       `json:"trend"`
+}
+
+// SummarizeStats returns the stats of each task in the giving records, ordered
+// by Tson and task name.
+func SummarizeStats(records []StatRecord) []TaskStats {
+	type key struct{ tson, task string }
+
+	runs := make(map[key][]StatRecord)
+	var keys []key
+
+	for _, record := range records {
+		k := key{record.Tson, record.Name}
+		if _, ok := runs[k]; !ok {
+			keys = append(keys, k)
+		}
+
+		runs[k] = append(runs[k], record)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].tson != keys[j].tson {
+			return keys[i].tson < keys[j].tson
+		}
+
+		return keys[i].task < keys[j].task
+	})
+
+	var stats []TaskStats
+	for _, k := range keys {
+		stats = append(stats, summarize(k.tson, k.task, runs[k]))
+	}
+
+	return stats
+}
+
+// summarize returns the stats of the named task from its giving records.
+func summarize(tson, task string, records []StatRecord) TaskStats {
+	stats := TaskStats{Tson: tson, Task: task, Runs: len(records)}
+
+	var walls []time.Duration
+	var user, system time.Duration
+
+	for _, record := range records {
+		if record.Ended.After(stats.Last) {
+			stats.Last = record.Ended
+		}
+
+		if record.Status == StatusFailed || record.Status == StatusTimedOut {
+			stats.Failed++
+		}
+
+		if record.Usage == nil {
+			continue
+		}
+
+		if record.Usage.MaxRSS > stats.PeakRSS {
+			stats.PeakRSS = record.Usage.MaxRSS
+		}
+
+		if record.Status == StatusStopped {
+			continue
+		}
+
+		walls = append(walls, record.Usage.Wall)
+		user += record.Usage.User
+		system += record.Usage.System
+
+		if record.Usage.Wall > stats.MaxWall {
+			stats.MaxWall = record.Usage.Wall
+		}
+	}
+
+	if len(walls) == 0 {
+		return stats
+	}
+
+	stats.Wall = average(walls)
+	stats.User = user / time.Duration(len(walls))
+	stats.System = system / time.Duration(len(walls))
+
+	recent := trendRuns
+	if len(walls) < 2*recent {
+		recent = len(walls) / 2
+	}
+
+	if recent != 0 {
+		latest := average(walls[len(walls)-recent:])
+		before := average(walls[len(walls)-2*recent : len(walls)-recent])
+
+		if before > 0 {
+			stats.Trend = float64(latest-before) / float64(before)
+		}
+	}
+
+	return stats
+}
+
+// average returns the mean of the giving durations.
+func average(durations []time.Duration) time.Duration {
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+
+	return total / time.Duration(len(durations))
+}
@@ -0,0 +1,126 @@
+package tasks_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+func TestStatsLog(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+
+	var buf syncBuffer
+
+	series := tasks.New(&tasks.Tson{
+		Name:       "build",
+		Sink:       &buf,
+		WriteDelay: "10ms",
+		Tasks: []*tasks.MasterTask{{
+			Before: []*tasks.Task{rec.task("vet")},
+			Main:   rec.task("compile", "fail"),
+		}},
+	})
+
+	series.Stats = tasks.NewStatsLog(path)
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	series.Wait()
+
+	if !strings.Contains(buf.String(), "Usage: wall") {
+		t.Fatalf("Should have written usage of tasks: %q", buf.String())
+	}
+
+	records, err := tasks.ReadStats(path)
+	if err != nil {
+		t.Fatalf("Should have read stats: %q", err.Error())
+	}
+
+	if len(records) != 2 || records[0].Tson != "build" || records[0].Name != "vet" || records[1].Status != tasks.StatusFailed {
+		t.Fatalf("Should have recorded each task: %+v", records)
+	}
+
+	if records[1].Usage == nil || records[1].Usage.Wall <= 0 {
+		t.Fatalf("Should have recorded usage: %+v", records[1])
+	}
+
+	log := tasks.NewStatsLog(path)
+
+	run := func(wall time.Duration, status string) {
+		res := tasks.TaskResult{Name: "test", Status: status, Ended: time.Now(), Usage: &tasks.Usage{Wall: wall, MaxRSS: 1024}}
+		if err := log.Record("ci", res); err != nil {
+			t.Fatalf("Should have recorded result: %q", err.Error())
+		}
+	}
+
+	for _, wall := range []time.Duration{100, 100, 100, 150, 150, 150} {
+		run(wall*time.Millisecond, tasks.StatusDone)
+	}
+
+	run(time.Hour, tasks.StatusStopped)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Should have opened stats: %q", err.Error())
+	}
+
+	file.WriteString(`{"tson": "ci", "na`)
+	file.Close()
+
+	records, err = tasks.ReadStats(path)
+	if err != nil || len(records) != 9 {
+		t.Fatalf("Should have skipped partial record: %d %v", len(records), err)
+	}
+
+	stats := tasks.SummarizeStats(records)
+	if len(stats) != 3 || stats[0].Tson != "build" || stats[2].Tson != "ci" {
+		t.Fatalf("Should have summarized each task: %+v", stats)
+	}
+
+	ci := stats[2]
+	if ci.Runs != 7 || ci.Wall != 125*time.Millisecond || ci.MaxWall != 150*time.Millisecond || ci.PeakRSS != 1024 {
+		t.Fatalf("Should have left stopped runs out of times: %+v", ci)
+	}
+
+	if ci.Trend != 0.5 {
+		t.Fatalf("Should have compared latest runs with those before: %v", ci.Trend)
+	}
+
+	if stats[0].Task != "compile" || stats[0].Failed != 1 {
+		t.Fatalf("Should have counted failed runs: %+v", stats[0])
+	}
+
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Should have found stats file: %q", err.Error())
+	}
+
+	if err := log.Trim(len(records)); err != nil {
+		t.Fatalf("Should have left stats untrimmed: %q", err.Error())
+	}
+
+	if after, _ := os.Stat(path); after == nil || !os.SameFile(before, after) {
+		t.Fatal("Should not have rewritten stats file within limit")
+	}
+
+	if err := log.Trim(3); err != nil {
+		t.Fatalf("Should have trimmed stats: %q", err.Error())
+	}
+
+	if records, _ = tasks.ReadStats(path); len(records) != 3 || records[2].Status != tasks.StatusStopped {
+		t.Fatalf("Should have kept latest records: %+v", records)
+	}
+
+	if files, _ := ioutil.ReadDir(filepath.Dir(path)); len(files) != 1 {
+		t.Fatalf("Should have replaced stats file with trimmed one: %d files", len(files))
+	}
+}
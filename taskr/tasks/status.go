@@ -0,0 +1,164 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Status values which a task's result can have.
+const (
+	StatusPending  = "pending"
+	StatusRunning  = "running"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+	StatusStopped  = "stopped"
+	StatusTimedOut = "timed out"
+	StatusSkipped  = "skipped"
+)
+
+// TaskResult defines the outcome of the current or last run of a Task.
+type TaskResult struct {
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	ExitCode int       `json:"exit_code"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Ended    time.Time `json:"ended"`
+	Usage    *Usage    `json:"usage,omitempty"`
+}
+
+// Duration returns the time the task has been running for or ran for.
+func (tr TaskResult) Duration() time.Duration {
+	if tr.Started.IsZero() {
+		return 0
+	}
+
+	if tr.Ended.IsZero() {
+		return time.Since(tr.Started)
+	}
+
+	return tr.Ended.Sub(tr.Started)
+}
+
+// Usage defines the resources used by the last attempt of a task: the time it
+// ran for, the CPU time its process spent in user and system mode and its peak
+// resident memory in bytes, which is only known on linux. Tasks carried out by
+// taskr itself only have their wall time.
+type Usage struct {
+	Wall   time.Duration `json:"wall"`
+	User   time.Duration `json:"user,omitempty"`
+	System time.Duration `json:"system,omitempty"`
+	MaxRSS int64         `json:"max_rss,omitempty"`
+}
+
+// String returns the usage as a line of comma separated values.
+func (u Usage) String() string {
+	values := []string{"wall " + u.Wall.Round(time.Millisecond).String()}
+
+	if u.User != 0 || u.System != 0 {
+		values = append(values, "user "+u.User.Round(time.Millisecond).String())
+		values = append(values, "system "+u.System.Round(time.Millisecond).String())
+	}
+
+	if u.MaxRSS != 0 {
+		values = append(values, "max rss "+FormatBytes(u.MaxRSS))
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// FormatBytes returns the giving number of bytes in the largest unit in which
+// it is at least one, e.g 34.2MB.
+func FormatBytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// MasterTaskStatus defines the state of all tasks of a MasterTask.
+type MasterTaskStatus struct {
+	Name    string       `json:"name"`
+	Main    TaskResult   `json:"main"`
+	Before  []TaskResult `json:"before"`
+	After   []TaskResult `json:"after"`
+	History []TaskResult `json:"history"`
+}
+
+// TsonStatus defines the state of a Tson and all its tasks.
+type TsonStatus struct {
+	Name        string             `json:"name"`
+	Description string             `json:"desc"`
+	Paused      bool               `json:"paused"`
+	Tasks       []MasterTaskStatus `json:"tasks"`
+	Matrices    []MatrixStatus     `json:"matrices,omitempty"`
+	Teardown    []TaskResult       `json:"teardown,omitempty"`
+}
+
+// Status returns the current state of the tasks in the MasterTask.
+func (mt *MasterTask) Status() MasterTaskStatus {
+	var status MasterTaskStatus
+
+	if mt.Main != nil {
+		status.Name = mt.Main.Name
+		status.Main = mt.Main.Result()
+		status.History = mt.Main.History()
+	}
+
+	for _, tk := range mt.Before {
+		status.Before = append(status.Before, tk.Result())
+	}
+
+	for _, tk := range mt.After {
+		status.After = append(status.After, tk.Result())
+	}
+
+	return status
+}
+
+// Status returns the current state of the Tson and its tasks.
+func (t *Tson) Status() TsonStatus {
+	status := TsonStatus{
+		Name:        t.ID(),
+		Description: t.Description,
+		Paused:      t.Paused(),
+	}
+
+	mts := t.masterTasks()
+
+	for _, mt := range mts {
+		status.Tasks = append(status.Tasks, mt.Status())
+	}
+
+	for _, group := range t.matrices {
+		status.Matrices = append(status.Matrices, group.status(mts))
+	}
+
+	for _, tk := range t.Teardown {
+		status.Teardown = append(status.Teardown, tk.Result())
+	}
+
+	return status
+}
+
+// Status returns the current state of all Tsons in the series.
+func (ts *TsonSeries) Status() []TsonStatus {
+	var status []TsonStatus
+
+	for _, tson := range ts.Tsons() {
+		status = append(status, tson.Status())
+	}
+
+	return status
+}
@@ -1,151 +1,595 @@
 package tasks
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"runtime"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 )
 
+// maxHistory sets the number of previous results kept for a task.
+const maxHistory = 20
+
+// outputWait sets the maximum time to wait for the output of a command after it
+// exits.
+const outputWait = 2 * time.Second
+
+// defaultRetryDelay sets the delay before the first retry of a failed task,
+// which doubles for every further retry.
+const defaultRetryDelay = time.Second
+
 // Task defines a struct which holds commands which must be executed when runned.
 type Task struct {
-	Name        string   `json:"name"`
-	Command     string   `json:"command"`
-	Parameters  []string `json:"params"`
-	Description string   `json:"desc"`
-	EndCheck    time.Duration
-	commando    *exec.Cmd
-	running     bool
-	rl          sync.Mutex
+	Name             string            `json:"name"`
+	Type             string            `json:"type,omitempty"`
+	Command          string            `json:"command"`
+	Parameters       []string          `json:"params,omitempty"`
+	Description      string            `json:"desc,omitempty"`
+	Interactive      bool              `json:"interactive,omitempty"`
+	TTY              bool              `json:"tty,omitempty"`
+	Lock             string            `json:"lock,omitempty"`
+	Retries          int               `json:"retries,omitempty"`
+	RetryDelay       string            `json:"retry_delay,omitempty"`
+	RetryOnExitCodes []int             `json:"retry_on_exit_codes,omitempty"`
+	Timeout          string            `json:"timeout,omitempty"`
+	If               *Condition        `json:"if,omitempty"`
+	Env              map[string]string `json:"env,omitempty"`
+	Secrets          []string          `json:"secrets,omitempty"`
+	EndCheck         time.Duration     `json:"-"` // Deprecated: no longer used.
+	Input            io.Reader         `json:"-"`
+	Terminal         io.Writer         `json:"-"`
+	current          Executor
+	cancel           context.CancelFunc
+	running          bool
+	done             chan struct{}
+	runs             int
+	defaultTimeout   time.Duration
+	stopc            chan struct{}
+	secrets          *strings.Replacer
+	masked           []string
+	owner            *Tson
+	state            TaskState
+	states           stateFeed
+	result           TaskResult
+	history          []TaskResult
+	rl               sync.Mutex
+}
+
+// Result returns the result of the task's current or last run.
+func (t *Task) Result() TaskResult {
+	t.rl.Lock()
+	defer t.rl.Unlock()
+
+	res := t.result
+	if res.Name == "" {
+		res.Name = t.Name
+		res.Status = StatusPending
+	}
+
+	return res
+}
+
+// History returns the results of the task's previous runs, oldest first.
+func (t *Task) History() []TaskResult {
+	t.rl.Lock()
+	defer t.rl.Unlock()
+
+	return append([]TaskResult(nil), t.history...)
+}
+
+// setResult updates the result of the task's current run with the giving
+// function.
+func (t *Task) setResult(update func(*TaskResult)) {
+	t.rl.Lock()
+	update(&t.result)
+	t.rl.Unlock()
+}
+
+// trimHistory drops the oldest results beyond the maximum kept, it must be
+// called with the lock held.
+func (t *Task) trimHistory() {
+	if len(t.history) > maxHistory {
+		t.history = t.history[len(t.history)-maxHistory:]
+	}
 }
 
 // Wait blocks until the tasks completes or it gets stopped.
 func (t *Task) Wait() {
-	if t.commando == nil {
-		return
-	}
+	t.rl.Lock()
+	done := t.done
+	t.rl.Unlock()
 
-	t.commando.Wait()
+	if done != nil {
+		<-done
+	}
 }
 
-// Stopped returns true/false if the given task has been stopped or not started.
+// Stopped returns true/false if the given task has been stopped or ended, which
+// a task which has never run has not.
 func (t *Task) Stopped() bool {
-	if t.commando != nil && t.commando.ProcessState != nil {
-		return t.commando.ProcessState.Exited()
-	}
+	t.rl.Lock()
+	defer t.rl.Unlock()
 
-	return t.commando == nil
+	return !t.running && t.currentState() != StatePending
 }
 
-// Run initializes the task to be invoked.
+// Run initializes the task to be invoked. If the task is interactive, it is
+// attached to the terminal's input and output instead of the writers. If the
+// task sets TTY, it is run under a pseudo-terminal where supported.
 func (t *Task) Run(outw io.Writer, errw io.Writer) {
+	t.run(outw, errw, t.Interactive, nil)
+}
+
+// run initializes the task to be invoked, attaching it to the terminal if
+// interactive is true. Failed runs are retried as set by the task, and the
+// run is skipped if the task's condition does not hold for the changed files.
+func (t *Task) run(outw io.Writer, errw io.Writer, interactive bool, changed []string) {
+	if t.If != nil {
+		if ok, reason := t.If.Check(changed); !ok {
+			t.skip(outw, reason)
+			return
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+
 	t.rl.Lock()
+	t.runs++
+	gen := t.runs
 	t.running = true
+	t.stopc = stop
+	t.done = done
+	t.result = TaskResult{Name: t.Name, Status: StatusRunning, Started: time.Now()}
 	t.rl.Unlock()
 
-	t.commando = exec.Command(t.Command, t.Parameters...)
+	if t.Lock != "" {
+		lock := taskLocks.get(t.Lock)
+
+		if !lock.tryAcquire() {
+			fmt.Fprintf(outw, taskWaitLock, t.Name, t.Lock)
 
-	fmt.Fprintf(outw, task, t.Name, t.Description, t.Command, t.Parameters, "Executing")
-	t.inputLoop(outw, errw)
+			// A task stopped while waiting for the lock ends without running.
+			if !lock.acquire(stop) {
+				t.endRun(gen, time.Now(), TaskResult{Status: StatusStopped, ExitCode: -1})
+				return
+			}
+		}
 
-	if err := t.commando.Start(); err != nil {
+		defer lock.release()
+	}
+
+	started := time.Now()
+
+	delay, err := getDuration(t.RetryDelay, defaultRetryDelay)
+	if err != nil {
+		fmt.Fprintf(outw, taskError, t.Name, t.Description, t.Command, t.Parameters, err.Error())
+		t.endRun(gen, started, TaskResult{Status: StatusFailed, ExitCode: -1, Error: err.Error()})
+		return
+	}
+
+	timeout, err := getDuration(t.Timeout, t.defaultTimeout)
+	if err != nil {
 		fmt.Fprintf(outw, taskError, t.Name, t.Description, t.Command, t.Parameters, err.Error())
+		t.endRun(gen, started, TaskResult{Status: StatusFailed, ExitCode: -1, Error: err.Error()})
 		return
 	}
 
-	// Lunch a timer to check if the main had finished executing.
-	go func() {
-		for {
-			<-time.After(t.EndCheck)
+	var res TaskResult
 
-			if t.Stopped() {
-				t.Stop(outw)
-				return
-			}
+	for attempt := 1; ; attempt++ {
+		res = t.attempt(gen, attempt, timeout, outw, errw, interactive)
+		res.Attempts = attempt
+
+		if !t.retryable(gen, res) {
+			break
 		}
-	}()
 
-	t.commando.Wait()
+		fmt.Fprintf(outw, taskRetry, t.Name, attempt, t.Retries+1, res.ExitCode, delay.String())
 
-	if t.commando != nil && t.commando.ProcessState != nil {
-		fmt.Fprintf(outw, taskLogs, t.commando.ProcessState.String())
+		select {
+		case <-time.After(delay):
+		case <-stop:
+		}
+
+		delay *= 2
 	}
+
+	t.endRun(gen, started, res)
 }
 
-// inputLoop creates loops to read out and error details to be printed into
-// the writers for the task.
-func (t *Task) inputLoop(outM, errM io.Writer) {
-	fmt.Fprintf(outM, taskBegin, t.Name, t.Description)
+// skip records a run of the task which was skipped for the giving reason.
+func (t *Task) skip(outw io.Writer, reason string) {
+	fmt.Fprintf(outw, taskSkip, t.Name, reason)
+
+	now := time.Now()
+	res := TaskResult{Name: t.Name, Status: StatusSkipped, Started: now, Ended: now}
+
+	t.rl.Lock()
+	t.runs++
+	t.moveTo(StateExited)
+	t.result = res
+	t.history = append(t.history, t.result)
+	t.trimHistory()
+	t.rl.Unlock()
 
-	outReader, err := t.commando.StdoutPipe()
+	if t.owner != nil {
+		t.owner.taskSkipped(res)
+	}
+}
+
+// attempt carries out the task once as part of the run with the giving
+// generation, returning the result of the attempt. The attempt is ended once
+// the timeout passes if it is positive.
+func (t *Task) attempt(gen int, attempt int, timeout time.Duration, outw io.Writer, errw io.Writer, interactive bool) TaskResult {
+	ex, err := newExecutor(t)
 	if err != nil {
-		fmt.Fprintf(outM, taskError, t.Name, t.Description, t.Command, t.Parameters, err.Error())
+		fmt.Fprintf(outw, taskError, t.Name, t.Description, t.Command, t.Parameters, err.Error())
+		return t.endAttempt(gen, TaskResult{Status: StatusFailed, ExitCode: -1, Error: err.Error()})
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
 	} else {
-		go t.readInput(outReader, outM)
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	defer cancel()
+
+	if t.isStale(gen) {
+		return TaskResult{Status: StatusStopped, ExitCode: -1}
+	}
+
+	status := "Executing"
+	if t.Retries > 0 {
+		status = fmt.Sprintf("Executing (attempt %d of %d)", attempt, t.Retries+1)
+	}
+
+	fmt.Fprintf(outw, task, t.Name, t.Description, t.Command, t.Parameters, status)
+
+	// Output is held until observers know the task started.
+	ready := make(chan struct{})
+	st, flush := t.streams(outw, errw, interactive, ready)
+
+	// The executor is started with the lock held so a stop never misses it.
+	t.rl.Lock()
+	if gen != t.runs || !t.running {
+		t.rl.Unlock()
+		return TaskResult{Status: StatusStopped, ExitCode: -1}
 	}
 
-	errReader, err := t.commando.StderrPipe()
+	t.current = ex
+	t.cancel = cancel
+	t.result.Attempts = attempt
+	t.moveTo(StateStarting)
+	began := time.Now()
+	err = ex.Start(ctx, st)
+	if err == nil {
+		t.moveTo(StateRunning)
+	}
+	t.rl.Unlock()
+
+	if err == nil && t.owner != nil {
+		t.owner.taskStarted(t.Name)
+	}
+
+	close(ready)
+
 	if err != nil {
-		fmt.Fprintf(errM, taskError, t.Name, t.Description, t.Command, t.Parameters, err.Error())
+		fmt.Fprintf(outw, taskError, t.Name, t.Description, t.Command, t.Parameters, err.Error())
+		return t.endAttempt(gen, TaskResult{Status: StatusFailed, ExitCode: -1, Error: err.Error()})
+	}
+
+	werr := ex.Wait()
+	flush()
+
+	usage := Usage{Wall: time.Since(began)}
+	if ux, ok := ex.(interface{ Usage() (Usage, bool) }); ok {
+		if pu, ok := ux.Usage(); ok {
+			usage.User, usage.System, usage.MaxRSS = pu.User, pu.System, pu.MaxRSS
+		}
+	}
+
+	if werr != nil {
+		fmt.Fprintf(outw, taskLogs, werr.Error())
+	} else {
+		fmt.Fprintf(outw, taskLogs, "exit status 0")
+	}
+
+	fmt.Fprintf(outw, taskUsage, usage)
+
+	res := TaskResult{Status: StatusDone, ExitCode: exitCode(werr), Usage: &usage}
+
+	t.rl.Lock()
+	defer t.rl.Unlock()
+
+	switch {
+	case gen != t.runs || !t.running:
+		res.Status = StatusStopped
+	case ctx.Err() == context.DeadlineExceeded:
+		res.Status = StatusTimedOut
+		res.Error = fmt.Sprintf("timed out after %s", timeout)
+		fmt.Fprintf(outw, taskTimeout, t.Name, timeout.String())
+	case werr != nil:
+		res.Status = StatusFailed
+		res.Error = werr.Error()
+	}
+
+	if gen == t.runs {
+		t.moveTo(endState(res))
+	}
+
+	return res
+}
+
+// endAttempt moves the task to the state the attempt of the run with the giving
+// generation ended in, unless a newer run replaced it, and returns its result.
+func (t *Task) endAttempt(gen int, res TaskResult) TaskResult {
+	t.rl.Lock()
+	defer t.rl.Unlock()
+
+	if gen == t.runs {
+		t.moveTo(endState(res))
+	}
+
+	return res
+}
+
+// isStale returns true/false if the run with the giving generation has been
+// stopped or replaced by a newer run.
+func (t *Task) isStale(gen int) bool {
+	t.rl.Lock()
+	defer t.rl.Unlock()
+
+	return gen != t.runs || !t.running
+}
+
+// retryable returns true/false if the run with the giving generation should
+// retry after an attempt with the giving result.
+func (t *Task) retryable(gen int, res TaskResult) bool {
+	if res.Status != StatusFailed || res.Attempts > t.Retries {
+		return false
+	}
+
+	if t.isStale(gen) {
+		return false
+	}
+
+	if len(t.RetryOnExitCodes) == 0 {
+		return true
+	}
+
+	for _, code := range t.RetryOnExitCodes {
+		if code == res.ExitCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// endRun records the final result of the run with the giving generation. A
+// task restarted before this run ended has its result owned by the new run,
+// so this run is only recorded into the history as stopped. The result is
+// also handed to the task's Tson, if any, once recorded.
+func (t *Task) endRun(gen int, started time.Time, res TaskResult) {
+	if t.owner != nil {
+		defer func() {
+			t.owner.taskExited(res)
+		}()
+	}
+
+	t.rl.Lock()
+	defer t.rl.Unlock()
+
+	res.Name = t.Name
+	res.Started = started
+	res.Ended = time.Now()
+	res.Error = maskSecrets(t.secrets, res.Error)
+
+	if gen != t.runs {
+		res.Status = StatusStopped
 	} else {
-		go t.readInput(errReader, errM)
+		t.moveTo(endState(res))
+		t.result = res
+		t.running = false
+		t.current = nil
+		t.cancel = nil
 	}
+
+	t.history = append(t.history, res)
+	t.trimHistory()
 }
 
-func (t *Task) readInput(reader io.ReadCloser, out io.Writer) {
-	scanner := bufio.NewScanner(reader)
+// streams returns the streams for an attempt of the task along with a function
+// to print any last partial lines once it ends. Interactive tasks are attached
+// to the terminal, tasks run under a pseudo-terminal write their raw output
+// into the writers, and all others have their output written line by line once
+// ready is closed.
+func (t *Task) streams(outw, errw io.Writer, interactive bool, ready chan struct{}) (Streams, func()) {
+	var st Streams
+
+	if interactive {
+		fmt.Fprintf(outw, taskInteractive, t.Name, t.Description)
+
+		st.Stdin, st.Stdout, st.Stderr = t.Input, t.Terminal, t.Terminal
+		if st.Stdin == nil {
+			st.Stdin = os.Stdin
+		}
+
+		if t.Terminal == nil {
+			st.Stdout, st.Stderr = os.Stdout, os.Stderr
+		}
+
+		// Output of a command given the terminal itself can not be masked
+		// without keeping the command from using it as a terminal.
+		if len(t.masked) != 0 && (t.Terminal != nil || t.TTY && ptySupported) {
+			outm, errm := newMaskWriter(st.Stdout, t.masked), newMaskWriter(st.Stderr, t.masked)
+			st.Stdout, st.Stderr = outm, errm
+
+			return st, func() {
+				outm.Flush()
+				errm.Flush()
+			}
+		}
 
-	for scanner.Scan() {
-		t.rl.Lock()
-		if !t.running {
-			t.rl.Unlock()
+		return st, func() {}
+	}
+
+	fmt.Fprintf(outw, taskBegin, t.Name, t.Description)
+
+	// The raw output of a pseudo-terminal is masked before it is split into
+	// the writes of the Tson, so no secret is split across them.
+	if t.TTY && ptySupported && (t.Type == "" || t.Type == TypeExec) {
+		if len(t.masked) == 0 {
+			st.Stdout, st.Stderr = outw, errw
+			return st, func() {}
+		}
+
+		outm, errm := newMaskWriter(outw, t.masked), newMaskWriter(errw, t.masked)
+		st.Stdout, st.Stderr = outm, errm
+
+		return st, func() {
+			outm.Flush()
+			errm.Flush()
+		}
+	}
+
+	outl := &lineWriter{task: t, out: outw, ready: ready}
+	errl := &lineWriter{task: t, out: errw, ready: ready}
+	st.Stdout, st.Stderr = outl, errl
+
+	return st, func() {
+		outl.Flush()
+		errl.Flush()
+	}
+}
+
+// lineWriter writes each line written to it into a task's writer in the task
+// log format, dropping lines once the task is stopped. Lines wait until ready
+// is closed.
+type lineWriter struct {
+	task  *Task
+	out   io.Writer
+	ready chan struct{}
+	buf   []byte
+}
+
+// Write prints all complete lines in the giving bytes, keeping any partial
+// line until it is completed.
+func (lw *lineWriter) Write(bu []byte) (int, error) {
+	lw.buf = append(lw.buf, bu...)
+
+	for {
+		index := bytes.IndexByte(lw.buf, '\n')
+		if index == -1 {
 			break
 		}
-		t.rl.Unlock()
 
-		fmt.Fprintf(out, taskLogs, scanner.Text())
+		lw.line(lw.buf[:index])
+		lw.buf = lw.buf[index+1:]
+	}
+
+	return len(bu), nil
+}
+
+// Flush prints any partial line left.
+func (lw *lineWriter) Flush() {
+	if len(lw.buf) != 0 {
+		lw.line(lw.buf)
+		lw.buf = nil
+	}
+}
+
+func (lw *lineWriter) line(line []byte) {
+	<-lw.ready
+
+	lw.task.rl.Lock()
+	running := lw.task.running
+	lw.task.rl.Unlock()
+
+	if !running {
+		return
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	fmt.Fprintf(lw.out, taskLogs, line)
+
+	if lw.task.owner != nil {
+		lw.task.owner.taskOutput(lw.task.Name, maskSecrets(lw.task.secrets, string(line)))
 	}
 }
 
 // Stop ends the task which when initialized.
 func (t *Task) Stop(m io.Writer) {
-	if t.commando == nil {
+	t.rl.Lock()
+	defer t.rl.Unlock()
+
+	if !t.running {
 		return
 	}
 
+	t.running = false
+	t.moveTo(StateStopping)
+
+	if t.stopc != nil {
+		close(t.stopc)
+		t.stopc = nil
+	}
+
+	if t.current == nil {
+		return
+	}
+
+	if err := t.current.Stop(); err != nil {
+		fmt.Fprintf(m, taskKill, t.Name, t.Description, t.Command, t.Parameters, err.Error())
+	}
+}
+
+// Kill ends the task at once, killing its command where its executor has a
+// Kill() error method instead of asking it to stop. A task already asked to
+// stop is killed if it has not ended.
+func (t *Task) Kill(m io.Writer) {
 	t.rl.Lock()
-	if !t.running {
-		t.rl.Unlock()
+	defer t.rl.Unlock()
+
+	if !t.running && t.current == nil {
 		return
 	}
-	t.rl.Unlock()
 
 	t.running = false
+	t.moveTo(StateStopping)
 
-	var err error
+	if t.stopc != nil {
+		close(t.stopc)
+		t.stopc = nil
+	}
 
-	if t.commando != nil {
-		if t.commando.Process != nil {
+	if t.cancel != nil {
+		t.cancel()
+	}
 
-			if runtime.GOOS == "windows" {
-				err = t.commando.Process.Kill()
-			} else {
-				err = t.commando.Process.Signal(os.Interrupt)
-			}
+	if t.current == nil {
+		return
+	}
 
-		}
+	var err error
 
-		if t.commando.ProcessState != nil {
-			if ws, ok := t.commando.ProcessState.Sys().(syscall.WaitStatus); ok {
-				if ws.ExitStatus() != 0 && err != nil {
-					fmt.Fprintf(m, taskKill, t.Name, t.Description, t.Command, t.Parameters, err.Error())
-				}
-			}
-		}
+	if killer, ok := t.current.(interface{ Kill() error }); ok {
+		err = killer.Kill()
+	} else {
+		err = t.current.Stop()
+	}
+
+	if err != nil {
+		fmt.Fprintf(m, taskKill, t.Name, t.Description, t.Command, t.Parameters, err.Error())
 	}
 }
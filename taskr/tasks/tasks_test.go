@@ -2,6 +2,16 @@ package tasks_test
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -9,44 +19,20 @@ import (
 )
 
 func TestTSON(t *testing.T) {
+	rec := newFakeRecorder(t)
 
-	var buf bytes.Buffer
+	var buf syncBuffer
 	var tson tasks.Tson
 
 	tson.Sink = &buf
 	tson.FilesGlob = []string{"./*"}
 	tson.Description = "Manages running of all master task"
-	tson.WriteDelay = "100ms"
+	tson.WriteDelay = "10ms"
 	tson.Tasks = []*tasks.MasterTask{
 		{
-			MaxRunTime: "20s",
-			Main: &tasks.Task{
-				Name:        "TodaysFileReport",
-				Description: "Finds all modified files today",
-				Command:     "find",
-				Parameters:  []string{"~ -type f -mtime 0"},
-			},
-			Before: []*tasks.Task{
-				{
-					Name:        "ListDir",
-					Description: "List Current Dir",
-					Command:     "ls",
-				},
-				{
-					Name:        "EchoName",
-					Description: "Echo Starting",
-					Command:     "echo",
-					Parameters:  []string{"'Starting Todays report'"},
-				},
-			},
-			After: []*tasks.Task{
-				{
-					Name:        "EchoName",
-					Description: "Echo Ending",
-					Command:     "echo",
-					Parameters:  []string{"'Ending Todays report'"},
-				},
-			},
+			Main:   rec.task("Report", "Todays report", "block"),
+			Before: []*tasks.Task{rec.task("ListDir", "tasks.go"), rec.task("EchoStart", "Starting Todays report")},
+			After:  []*tasks.Task{rec.task("EchoEnd", "Ending Todays report")},
 		},
 	}
 
@@ -54,61 +40,459 @@ func TestTSON(t *testing.T) {
 		t.Fatalf("\tFailed: \t Error occurred in start tson: %q", err.Error())
 	}
 
-	go func() {
-		<-time.After(5 * time.Second)
-		tson.Restart()
-	}()
+	waitFor(t, "main task to start", func() bool { return rec.count("Report") == 1 })
 
-	go func() {
-		<-time.After(10 * time.Second)
-		tson.Stop()
-	}()
+	if runs := rec.runs(); strings.Join(runs, ",") != "ListDir,EchoStart,Report" {
+		t.Fatalf("Should have run before tasks ahead of main task: %+q", runs)
+	}
+
+	tson.Restart()
+
+	waitFor(t, "main task to restart", func() bool { return rec.count("Report") == 2 })
 
+	tson.Stop()
 	tson.Wait()
+	tson.Tasks[0].Main.Wait()
 
-	if buf.Len() == 0 {
-		t.Fatal("Should  have contain data after tasks execution.")
+	history := tson.Tasks[0].Main.History()
+	if len(history) != 2 || history[0].Status != tasks.StatusStopped || history[1].Status != tasks.StatusStopped {
+		t.Fatalf("Should have stopped both runs of main task: %+v", history)
 	}
+
+	waitFor(t, "task output in sink", func() bool {
+		return strings.Contains(buf.String(), "Starting Todays report")
+	})
 }
 
 func TestMasterTask(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	mtask := tasks.MasterTask{
+		Main:   rec.task("Report", "Todays report"),
+		Before: []*tasks.Task{rec.task("ListDir", "tasks.go"), rec.task("EchoStart", "Starting Todays report")},
+		After:  []*tasks.Task{rec.task("EchoEnd", "Ending Todays report")},
+	}
+
+	var buf bytes.Buffer
+	mtask.Run(&buf, &buf)
+
+	if runs := rec.runs(); strings.Join(runs, ",") != "ListDir,EchoStart,Report,EchoEnd" {
+		t.Fatalf("Should have run tasks in order: %+q", runs)
+	}
+
+	if res := mtask.Main.Result(); res.Status != tasks.StatusDone || res.ExitCode != 0 {
+		t.Fatalf("Should have completed main task: %+v", res)
+	}
+
+	for _, line := range []string{"tasks.go", "Starting Todays report", "Todays report", "Ending Todays report"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("Should have written %q into output: %q", line, buf.String())
+		}
+	}
+
+	mtask.Main.Parameters = []string{"fail"}
+	mtask.Run(&buf, &buf)
+
+	if res := mtask.Main.Result(); res.Status != tasks.StatusFailed || res.ExitCode != 1 {
+		t.Fatalf("Should have failed main task with exit code: %+v", res)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	tasks.RegisterFunc("greet", func(ctx context.Context, tk *tasks.Task, streams tasks.Streams) error {
+		for _, name := range tk.Parameters {
+			fmt.Fprintf(streams.Stdout, "Hello %s\n", name)
+		}
+
+		return nil
+	})
+
+	greet := tasks.Task{Name: "Greet", Type: "greet", Parameters: []string{"taskr"}}
+
+	var buf bytes.Buffer
+	greet.Run(&buf, &buf)
+
+	if res := greet.Result(); res.Status != tasks.StatusDone {
+		t.Fatalf("Should have completed function task: %+v", res)
+	}
+
+	if !strings.Contains(buf.String(), "Hello taskr") {
+		t.Fatalf("Should have written function output: %q", buf.String())
+	}
+
+	unknown := tasks.Task{Name: "Unknown", Type: "missing"}
+	unknown.Run(&buf, &buf)
+
+	if res := unknown.Result(); res.Status != tasks.StatusFailed {
+		t.Fatalf("Should have failed task of unknown type: %+v", res)
+	}
+}
+
+func TestInteractiveMasterTask(t *testing.T) {
+	var term bytes.Buffer
 
 	mtask := tasks.MasterTask{
-		MaxRunTime: "20s",
 		Main: &tasks.Task{
-			Name:        "TodaysFileReport",
-			Description: "Finds all modified files today",
-			Command:     "find",
-			Parameters:  []string{"~ -type f -mtime 0"},
+			Name:        "Repl",
+			Description: "Echos back terminal input",
+			Command:     "cat",
+			Interactive: true,
+			Input:       strings.NewReader("hello from terminal\n"),
+			Terminal:    &term,
 		},
 		Before: []*tasks.Task{
-			{
-				Name:        "ListDir",
-				Description: "List Current Dir",
-				Command:     "ls",
-			},
 			{
 				Name:        "EchoName",
 				Description: "Echo Starting",
 				Command:     "echo",
-				Parameters:  []string{"'Starting Todays report'"},
+				Parameters:  []string{"Starting repl"},
+				Interactive: true,
+				Terminal:    &term,
 			},
 		},
-		After: []*tasks.Task{
-			{
-				Name:        "EchoName",
-				Description: "Echo Ending",
-				Command:     "echo",
-				Parameters:  []string{"'Ending Todays report'"},
+	}
+
+	var buf bytes.Buffer
+	if err := mtask.Run(&buf, &buf); err != nil {
+		t.Fatalf("\tFailed: \t Error occurred running master task: %q", err.Error())
+	}
+
+	if !strings.Contains(term.String(), "hello from terminal") {
+		t.Fatalf("Should have echoed terminal input into terminal: %q", term.String())
+	}
+
+	if strings.Contains(term.String(), "Starting repl") {
+		t.Fatalf("Should have captured before task output: %q", term.String())
+	}
+
+	if !strings.Contains(buf.String(), "Starting repl") {
+		t.Fatalf("Should have written before task output to writers: %q", buf.String())
+	}
+}
+
+func TestTTYTask(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Pseudo-terminals are only supported on linux")
+	}
+
+	task := tasks.Task{
+		Name:        "Progress",
+		Description: "Prints progress when attached to a terminal",
+		Command:     "sh",
+		Parameters:  []string{"-c", "test -t 1 && printf '10%%\\r100%%'"},
+		TTY:         true,
+	}
+
+	var buf bytes.Buffer
+	task.Run(&buf, &buf)
+
+	if !strings.Contains(buf.String(), "10%\r100%") {
+		t.Fatalf("Should have streamed raw terminal output: %q", buf.String())
+	}
+}
+
+func TestTTYTaskInput(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Pseudo-terminals are only supported on linux")
+	}
+
+	in, input, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Should have created pipe: %q", err.Error())
+	}
+
+	defer in.Close()
+	defer input.Close()
+
+	var term syncBuffer
+
+	quick := tasks.Task{Name: "Quick", Command: "true", TTY: true, Interactive: true, Input: in, Terminal: &term}
+
+	var buf bytes.Buffer
+	quick.Run(&buf, &buf)
+
+	// Input written after the first task ended must reach the next one.
+	if _, err := input.Write([]byte("next\n")); err != nil {
+		t.Fatalf("Should have written input: %q", err.Error())
+	}
+
+	prompt := tasks.Task{
+		Name:        "Prompt",
+		Command:     "sh",
+		Parameters:  []string{"-c", "read line; echo got:$line"},
+		TTY:         true,
+		Interactive: true,
+		Input:       in,
+		Terminal:    &term,
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		prompt.Run(&buf, &buf)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		prompt.Stop(ioutil.Discard)
+		t.Fatal("Should have passed input to the next task")
+	}
+
+	if !strings.Contains(term.String(), "got:next") {
+		t.Fatalf("Should have read input in next task: %q", term.String())
+	}
+}
+
+func TestTaskRetries(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "attempted")
+
+	flaky := tasks.Task{
+		Name:       "Flaky",
+		Command:    "sh",
+		Parameters: []string{"-c", "test -f " + marker + " && exit 0; touch " + marker + "; exit 1"},
+		Retries:    3,
+		RetryDelay: "10ms",
+	}
+
+	var buf bytes.Buffer
+	flaky.Run(&buf, &buf)
+
+	if res := flaky.Result(); res.Status != tasks.StatusDone || res.Attempts != 2 {
+		t.Fatalf("Should have passed flaky task on second attempt: %+v", res)
+	}
+
+	if !strings.Contains(buf.String(), "attempt 2 of 4") {
+		t.Fatalf("Should have logged each attempt: %q", buf.String())
+	}
+
+	failing := tasks.Task{
+		Name:       "Failing",
+		Command:    "sh",
+		Parameters: []string{"-c", "exit 3"},
+		Retries:    2,
+		RetryDelay: "10ms",
+	}
+
+	failing.Run(&buf, &buf)
+
+	if res := failing.Result(); res.Status != tasks.StatusFailed || res.Attempts != 3 || res.ExitCode != 3 {
+		t.Fatalf("Should have failed after all attempts: %+v", res)
+	}
+
+	failing.RetryOnExitCodes = []int{4}
+	failing.Run(&buf, &buf)
+
+	if res := failing.Result(); res.Status != tasks.StatusFailed || res.Attempts != 1 {
+		t.Fatalf("Should not have retried unlisted exit code: %+v", res)
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	slow := tasks.Task{
+		Name:       "Slow",
+		Command:    "sleep",
+		Parameters: []string{"5"},
+		Timeout:    "100ms",
+		Retries:    2,
+	}
+
+	var buf bytes.Buffer
+
+	started := time.Now()
+	slow.Run(&buf, &buf)
+
+	if res := slow.Result(); res.Status != tasks.StatusTimedOut || res.Attempts != 1 {
+		t.Fatalf("Should have timed out slow task without retrying: %+v", res)
+	}
+
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("Should have stopped slow task shortly after its timeout: %s", elapsed)
+	}
+
+	var tson tasks.Tson
+
+	tson.Sink = &buf
+	tson.WriteDelay = "10ms"
+	tson.Timeout = "100ms"
+	tson.Tasks = []*tasks.MasterTask{
+		{
+			Main: &tasks.Task{
+				Name:       "Slow Main",
+				Command:    "sleep",
+				Parameters: []string{"5"},
 			},
 		},
 	}
 
+	if err := tson.Start(); err != nil {
+		t.Fatalf("\tFailed: \t Error occurred in start tson: %q", err.Error())
+	}
+
+	tson.Wait()
+
+	if res := tson.Tasks[0].Main.Result(); res.Status != tasks.StatusTimedOut {
+		t.Fatalf("Should have timed out main task with tson timeout: %+v", res)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	t.Setenv("TASKR_TEST_ENV", "staging")
+
+	dir := t.TempDir()
+
+	conditions := []struct {
+		cond    tasks.Condition
+		changed []string
+		holds   bool
+	}{
+		{tasks.Condition{Env: "TASKR_TEST_ENV"}, nil, true},
+		{tasks.Condition{Env: "TASKR_TEST_ENV=staging"}, nil, true},
+		{tasks.Condition{Env: "TASKR_TEST_ENV=production"}, nil, false},
+		{tasks.Condition{Env: "TASKR_TEST_UNSET"}, nil, false},
+		{tasks.Condition{Exists: dir}, nil, true},
+		{tasks.Condition{Exists: filepath.Join(dir, "node_modules"), Not: true}, nil, true},
+		{tasks.Condition{Command: []string{"true"}}, nil, true},
+		{tasks.Condition{Command: []string{"false"}}, nil, false},
+		{tasks.Condition{Changed: "migrations/*.sql"}, []string{"./migrations/001.sql"}, true},
+		{tasks.Condition{Changed: "migrations/*.sql"}, []string{"main.go"}, false},
+		{tasks.Condition{Changed: "migrations/*.sql"}, nil, false},
+		{tasks.Condition{Env: "TASKR_TEST_ENV", Command: []string{"false"}}, nil, false},
+	}
+
+	for _, cd := range conditions {
+		if holds, reason := cd.cond.Check(cd.changed); holds != cd.holds {
+			t.Fatalf("Condition %+v should have returned %t: %q", cd.cond, cd.holds, reason)
+		}
+	}
+
 	var buf bytes.Buffer
-	mtask.Run(&buf, &buf)
 
-	if buf.Len() == 0 {
-		t.Fatal("Should  have contain data after tasks execution.")
+	mt := tasks.MasterTask{
+		If: &tasks.Condition{Exists: dir, Not: true},
+		Main: &tasks.Task{
+			Name:    "Install",
+			Command: "echo",
+		},
 	}
 
+	mt.Run(&buf, &buf)
+
+	if res := mt.Main.Result(); res.Status != tasks.StatusSkipped {
+		t.Fatalf("Should have skipped master task when condition fails: %+v", res)
+	}
+
+	mt.If = nil
+	mt.Main.If = &tasks.Condition{Env: "TASKR_TEST_ENV=staging"}
+	mt.Run(&buf, &buf)
+
+	if res := mt.Main.Result(); res.Status != tasks.StatusDone {
+		t.Fatalf("Should have run task when condition holds: %+v", res)
+	}
+}
+
+func TestBuiltinTasks(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	if err := os.MkdirAll(filepath.Join(src, "nested"), 0755); err != nil {
+		t.Fatalf("Should have created source dir: %q", err.Error())
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "nested", "app.tmpl"), []byte("env={{.Env.STAGE}}"), 0644); err != nil {
+		t.Fatalf("Should have created template: %q", err.Error())
+	}
+
+	steps := []*tasks.Task{
+		{Name: "Mkdir", Type: tasks.TypeMkdir, Parameters: []string{dst}},
+		{Name: "Copy", Type: tasks.TypeCopy, Parameters: []string{src, dst}},
+		{
+			Name:       "Render",
+			Type:       tasks.TypeTemplate,
+			Parameters: []string{filepath.Join(dst, "src", "nested", "app.tmpl"), filepath.Join(dst, "app.conf")},
+			Env:        map[string]string{"STAGE": "test"},
+		},
+		{Name: "Serve", Type: tasks.TypeServe, Parameters: []string{dst, "127.0.0.1:0"}},
+	}
+
+	var buf bytes.Buffer
+
+	for _, step := range steps[:3] {
+		step.Run(&buf, &buf)
+
+		if res := step.Result(); res.Status != tasks.StatusDone {
+			t.Fatalf("Should have completed %q task: %+v", step.Type, res)
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dst, "app.conf")); err != nil || string(data) != "env=test" {
+		t.Fatalf("Should have rendered template with task env: %q", data)
+	}
+
+	remove := tasks.Task{Name: "Remove", Type: tasks.TypeRemove, Parameters: []string{dst}}
+	remove.Run(&buf, &buf)
+
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("Should have removed destination: %+v", remove.Result())
+	}
+
+	sleep := tasks.Task{Name: "Sleep", Type: tasks.TypeSleep, Parameters: []string{"5s"}, Timeout: "50ms"}
+	sleep.Run(&buf, &buf)
+
+	if res := sleep.Result(); res.Status != tasks.StatusTimedOut {
+		t.Fatalf("Should have timed out sleep task: %+v", res)
+	}
+
+	serve := steps[3]
+	go serve.Run(&buf, &buf)
+
+	<-time.After(100 * time.Millisecond)
+	serve.Stop(&buf)
+	serve.Wait()
+
+	if res := serve.Result(); res.Status != tasks.StatusStopped {
+		t.Fatalf("Should have stopped serve task: %+v", res)
+	}
+
+	invalid := tasks.Task{Name: "Invalid", Type: tasks.TypeCopy, Parameters: []string{src}}
+	invalid.Run(&buf, &buf)
+
+	if res := invalid.Result(); res.Status != tasks.StatusFailed || !strings.Contains(res.Error, "expects 2 params") {
+		t.Fatalf("Should have failed task with missing params: %+v", res)
+	}
+}
+
+func TestHTTPWaitTask(t *testing.T) {
+	var ready int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt64(&ready) == 0 {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+
+	wait := tasks.Task{
+		Name:       "Wait",
+		Type:       tasks.TypeHTTPWait,
+		Parameters: []string{server.URL, "10ms"},
+		Timeout:    "100ms",
+	}
+
+	wait.Run(&buf, &buf)
+
+	if res := wait.Result(); res.Status != tasks.StatusTimedOut {
+		t.Fatalf("Should have kept waiting on not found responses: %+v", res)
+	}
+
+	atomic.StoreInt64(&ready, 1)
+	wait.Run(&buf, &buf)
+
+	if res := wait.Result(); res.Status != tasks.StatusDone {
+		t.Fatalf("Should have finished once url responded: %+v", res)
+	}
 }
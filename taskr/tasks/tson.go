@@ -2,9 +2,11 @@ package tasks
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,11 +15,25 @@ import (
 	"github.com/influx6/faux/utils"
 )
 
+// defaultStopTimeout sets how long the tasks of a stopped Tson are given to end
+// before they are killed, unless its StopTimeout is set.
+const defaultStopTimeout = 10 * time.Second
+
 // TsonSeries defines a higher level Tson manager which handles the management
-// of a series of independent tasks providers.
+// of a series of independent tasks providers. The results of all tasks are
+// recorded into Stats if set, unless their Tson sets its own. Jobs limits the
+// MasterTasks running at once across all Tsons, leaving out services, with no
+// limit if 0.
 type TsonSeries struct {
-	Tasks []*Tson
-	wg    sync.WaitGroup
+	Tasks     []*Tson
+	Jobs      int
+	Stats     *StatsLog
+	jobs      semaphore
+	observers observerSet
+	stopping  bool
+	ml        sync.Mutex
+	reload    sync.Mutex
+	wg        sync.WaitGroup
 }
 
 // New returns a new instance of a TsonSeries.
@@ -28,60 +44,234 @@ func New(tsons ...*Tson) *TsonSeries {
 	return &series
 }
 
+// ErrManyInteractive is returned when more than one main task in a series
+// wishes to be attached to the terminal.
+var ErrManyInteractive = errors.New("Only one main task can be interactive")
+
+// interactiveMains returns the number of interactive main tasks of the giving
+// Tsons, counting a main task with a matrix once for each of its combinations.
+func interactiveMains(tsons []*Tson) int {
+	var count int
+
+	for _, tson := range tsons {
+		for _, mt := range tson.Tasks {
+			mts, err := mt.ExpandMatrix()
+			if err != nil {
+				mts = []*MasterTask{mt}
+			}
+
+			for _, emt := range mts {
+				if emt.Main != nil && emt.Main.Interactive {
+					count++
+				}
+			}
+		}
+	}
+
+	return count
+}
+
 // Start launches the series of internal Tson tasks managers, returning an error
 // if any fails to start.
 func (ts *TsonSeries) Start() error {
-	for _, tson := range ts.Tasks {
-		if err := tson.Start(); err != nil {
+	if interactiveMains(ts.Tsons()) > 1 {
+		return ErrManyInteractive
+	}
+
+	ts.jobs = newSemaphore(ts.Jobs)
+
+	for _, tson := range ts.Tsons() {
+		if err := ts.start(tson); err != nil {
 			return err
 		}
+	}
 
-		go func(tsn *Tson) {
-			tson.Wait()
-			ts.wg.Done()
-		}(tson)
+	return nil
+}
+
+// start starts the giving Tson as part of the series.
+func (ts *TsonSeries) start(tson *Tson) error {
+	tson.jobs = ts.jobs
+
+	tson.rm.Lock()
+	tson.series = ts
+	tson.rm.Unlock()
+
+	if tson.Stats == nil {
+		tson.Stats = ts.Stats
+	}
 
-		ts.wg.Add(1)
+	if err := tson.Start(); err != nil {
+		return err
 	}
 
+	ts.wg.Add(1)
+
+	go func() {
+		tson.Wait()
+		ts.wg.Done()
+	}()
+
 	return nil
 }
 
-// Stop stops the series of internal Tson tasks managers, returning an error
-// if any fails to start.
+// Tsons returns the Tsons of the series, which may change when it is reloaded.
+func (ts *TsonSeries) Tsons() []*Tson {
+	ts.ml.Lock()
+	defer ts.ml.Unlock()
+
+	return append([]*Tson(nil), ts.Tasks...)
+}
+
+// Stop stops the series of internal Tson tasks managers in the reverse of their
+// order, waiting for each to stop and run its teardown tasks before stopping
+// the next. A reload in progress is finished first, and later reloads are
+// refused.
 func (ts *TsonSeries) Stop() error {
-	for _, tson := range ts.Tasks {
-		tson.Stop()
+	ts.reload.Lock()
+	ts.stopping = true
+	ts.reload.Unlock()
+
+	tsons := ts.Tsons()
+
+	for index := len(tsons) - 1; index >= 0; index-- {
+		tsons[index].Stop()
+		tsons[index].Wait()
 	}
 
 	return nil
 }
 
+// Kill ends the tasks of all Tsons in the series at once, cutting short a stop
+// in progress.
+func (ts *TsonSeries) Kill() {
+	for _, tson := range ts.Tsons() {
+		tson.Kill()
+	}
+}
+
 // Wait calls the tson task runner to await all end calls for all tasks shutting
 // down the file watchers as well.
 func (ts *TsonSeries) Wait() {
 	ts.wg.Wait()
 }
 
+// ErrNotFound is returned when no Tson or MasterTask matches a giving name.
+var ErrNotFound = errors.New("No Tson or task found with name")
+
+// ErrStopping is returned when a series which is stopping is reloaded.
+var ErrStopping = errors.New("Series is stopping")
+
+// Find returns the Tson with the giving name.
+func (ts *TsonSeries) Find(name string) (*Tson, error) {
+	for _, tson := range ts.Tsons() {
+		if tson.ID() == name {
+			return tson, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// Restart restarts the Tson with the giving name, else the MasterTask whose
+// main task has the giving name.
+func (ts *TsonSeries) Restart(name string) error {
+	if tson, err := ts.Find(name); err == nil {
+		tson.Restart()
+		return nil
+	}
+
+	for _, tson := range ts.Tsons() {
+		if err := tson.RestartTask(name); err == nil {
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// Pause stops all Tsons in the series from restarting on file changes.
+func (ts *TsonSeries) Pause() {
+	for _, tson := range ts.Tsons() {
+		tson.Pause()
+	}
+}
+
+// Resume allows all Tsons in the series to restart on file changes.
+func (ts *TsonSeries) Resume() {
+	for _, tson := range ts.Tsons() {
+		tson.Resume()
+	}
+}
+
+// OneShot returns true/false if the series runs its tasks once and ends, which
+// is when none of its Tsons watch files or run on a schedule.
+func (ts *TsonSeries) OneShot() bool {
+	for _, tson := range ts.Tsons() {
+		if !tson.OneShot() {
+			return false
+		}
+	}
+
+	return true
+}
+
 //==============================================================================
 
 // Tson defines a struct which initializes and sets up a collection of tasks
 // which will be printed in accordance with the state of all tasks.
+// When stopped, its MasterTasks are stopped in the reverse of their order, each
+// given until StopTimeout in all to end before being killed, and then its
+// Teardown tasks are run in order. The values of the env vars named by Secrets
+// or by the secrets of its tasks are masked in all output it writes, and the
+// result of every run of its tasks is recorded into Stats if set.
 type Tson struct {
-	Description   string        `json:"desc"`
+	Name          string        `json:"name,omitempty"`
+	Description   string        `json:"desc,omitempty"`
 	Tasks         []*MasterTask `json:"tasks"`
 	FilesGlob     []string      `json:"files_glob,omitempty"`
 	Files         []string      `json:"files,omitempty"`
-	WriteDelay    string        `json:"write_delay"`
-	DebounceDelay string        `json:"debounce_delay"`
-	Events        string        `json:"events"`
+	WriteDelay    string        `json:"write_delay,omitempty"`
+	DebounceDelay string        `json:"debounce_delay,omitempty"`
+	Events        string        `json:"events,omitempty"`
+	Schedule      string        `json:"schedule,omitempty"`
+	Overlap       string        `json:"schedule_overlap,omitempty"`
+	MaxParallel   int           `json:"max_parallel,omitempty"`
+	Timeout       string        `json:"timeout,omitempty"`
+	StopTimeout   string        `json:"stop_timeout,omitempty"`
+	Teardown      []*Task       `json:"teardown,omitempty"`
+	Secrets       []string      `json:"secrets,omitempty"`
+	masked        []string
+	secrets       *strings.Replacer
 	writedelay    time.Duration
-	Sink          io.Writer
-	singleRun     chan struct{}
+	timeout       time.Duration
+	stopTimeout   time.Duration
+	forced        chan struct{}
+	force         sync.Once
+	defined       []*MasterTask
+	Sink          io.Writer `json:"-"`
+	Stats         *StatsLog `json:"-"`
+	sinkl         sync.Mutex
+	schedule      Schedule
+	scheduled     chan struct{}
+	runs          []int
+	changes       changeSet
+	matrices      []*matrixGroup
+	rm            sync.Mutex
+	parallel      semaphore
+	jobs          semaphore
+	singleRun     chan taskRun
 	killer        chan struct{}
-	restarter     chan struct{}
+	restarter     chan string
+	taskRestarter chan int
+	taskReloader  chan map[int]*MasterTask
 	starter       chan struct{}
+	ended         chan struct{}
 	rebooting     int64
+	paused        int64
+	feed          LogFeed
+	observers     *observerSet
+	series        *TsonSeries
 	watcher       *FileSystemWatch
 	twriters      *TsonWriter
 	wg            sync.WaitGroup
@@ -89,20 +279,109 @@ type Tson struct {
 	ticker        *time.Ticker
 }
 
+// taskRun identifies a single run of the task at index, allowing the end of runs
+// replaced by a restart to be told apart from the current run.
+type taskRun struct {
+	index int
+	gen   int
+}
+
 // Wait calls the tson task runner to await all end calls for all tasks shutting
 // down the file watchers as well.
 func (t *Tson) Wait() {
 	t.wg.Wait()
 }
 
+// ID returns the name of the Tson, else its description if no name is set.
+func (t *Tson) ID() string {
+	if t.Name != "" {
+		return t.Name
+	}
+
+	return t.Description
+}
+
+// OneShot returns true/false if the Tson runs its tasks once and ends, which is
+// when it neither watches files nor runs on a schedule.
+func (t *Tson) OneShot() bool {
+	return t.FilesGlob == nil && t.Files == nil && t.Schedule == ""
+}
+
 // Restart restarts the tson task runner.
 func (t *Tson) Restart() {
-	t.restarter <- struct{}{}
+	select {
+	case t.restarter <- ReasonRestart:
+	case <-t.ended:
+	}
+}
+
+// RestartTask restarts the MasterTask whose main task has the giving name.
+func (t *Tson) RestartTask(name string) error {
+	for index, mt := range t.masterTasks() {
+		if mt.Main == nil || mt.Main.Name != name {
+			continue
+		}
+
+		select {
+		case t.taskRestarter <- index:
+		case <-t.ended:
+		}
+
+		return nil
+	}
+
+	return ErrNotFound
 }
 
 // Stop ends the tson task runner.
 func (t *Tson) Stop() {
-	t.killer <- struct{}{}
+	select {
+	case t.killer <- struct{}{}:
+	case <-t.ended:
+	}
+}
+
+// Kill ends the tson task runner and its tasks at once, including its teardown
+// tasks, and keeps a stop in progress from waiting on them or running further
+// teardown tasks.
+func (t *Tson) Kill() {
+	if t.forced == nil {
+		return
+	}
+
+	t.force.Do(func() {
+		close(t.forced)
+		go t.Stop()
+	})
+
+	for index, mt := range t.masterTasks() {
+		mt.Kill(t.twriters.Writer(index))
+	}
+
+	for _, tk := range t.Teardown {
+		tk.Kill(t.teardownWriter())
+	}
+}
+
+// Pause stops the tson task runner from restarting its tasks on file changes.
+func (t *Tson) Pause() {
+	atomic.StoreInt64(&t.paused, 1)
+}
+
+// Resume allows the tson task runner to restart its tasks on file changes.
+func (t *Tson) Resume() {
+	atomic.StoreInt64(&t.paused, 0)
+}
+
+// Paused returns true/false if the tson task runner is paused.
+func (t *Tson) Paused() bool {
+	return atomic.LoadInt64(&t.paused) == 1
+}
+
+// Tail returns a channel which receives all output written by the tson task
+// runner and a function to end the subscription.
+func (t *Tson) Tail() (<-chan []byte, func()) {
+	return t.feed.Subscribe()
 }
 
 // Start intializes all internal structure for the runner and initializes each
@@ -114,6 +393,52 @@ func (t *Tson) Start() error {
 	}
 
 	t.writedelay = delay
+	t.schedule = nil
+
+	t.defined = append([]*MasterTask(nil), t.Tasks...)
+
+	expanded, matrices, err := expandMatrices(t.Tasks)
+	if err != nil {
+		return err
+	}
+
+	t.Tasks = expanded
+	t.matrices = matrices
+
+	t.timeout, err = getDuration(t.Timeout, 0)
+	if err != nil {
+		return err
+	}
+
+	t.stopTimeout, err = getDuration(t.StopTimeout, defaultStopTimeout)
+	if err != nil {
+		return err
+	}
+
+	for _, mt := range t.Tasks {
+		mt.timeout = t.timeout
+	}
+
+	t.masked = secretValues(t.Secrets, t.allTasks())
+	t.secrets = secretMasker(t.masked)
+	for _, tk := range t.allTasks() {
+		t.prepareTask(tk)
+	}
+
+	if t.Schedule != "" {
+		schedule, err := ParseSchedule(t.Schedule)
+		if err != nil {
+			return err
+		}
+
+		switch t.Overlap {
+		case "", OverlapSkip, OverlapQueue, OverlapRestart:
+		default:
+			return fmt.Errorf("Unknown schedule_overlap %q, expected skip, queue or restart", t.Overlap)
+		}
+
+		t.schedule = schedule
+	}
 
 	if t.FilesGlob != nil || t.Files != nil {
 		debounce, err := utils.GetDuration(t.DebounceDelay)
@@ -124,18 +449,27 @@ func (t *Tson) Start() error {
 		}
 
 		watcher, err := FileSystemWatchFromGlob(t.FilesGlob, func(ev fsnotify.Event) {
-			if atomic.LoadInt64(&t.debounce) == 0 {
-				atomic.StoreInt64(&t.debounce, 1)
+			if t.Paused() {
+				return
+			}
 
-				if t.Events == "" {
-					t.restarter <- struct{}{}
-					return
-				}
+			// Events other than the one watched for neither restart the
+			// tasks nor count as changes for their conditions.
+			if t.Events != "" && t.Events != ev.Op.String() {
+				return
+			}
 
-				if t.Events == ev.Op.String() {
-					t.restarter <- struct{}{}
-					return
-				}
+			t.rm.Lock()
+			t.changes.add(ev.Name)
+			t.rm.Unlock()
+
+			t.notify(func(o Observer) {
+				o.FileChanged(t.ID(), ev.Name, ev.Op.String())
+			})
+
+			if atomic.LoadInt64(&t.debounce) == 0 {
+				atomic.StoreInt64(&t.debounce, 1)
+				t.restarter <- ReasonFiles
 			}
 		}, nil)
 
@@ -160,11 +494,26 @@ func (t *Tson) Start() error {
 	t.writeLog(bytes.NewBufferString(fmt.Sprintf("TSON Watchers Files: %+q\n", t.Files)))
 	t.writeLog(bytes.NewBufferString(fmt.Sprintf("TSON Watchers FilesGlob: %q\n", t.FilesGlob)))
 
+	if t.schedule != nil {
+		t.writeLog(bytes.NewBufferString(fmt.Sprintf("TSON Schedule: %q\n", t.Schedule)))
+	}
+
 	t.killer = make(chan struct{})
-	t.singleRun = make(chan struct{})
+	t.singleRun = make(chan taskRun)
+	t.scheduled = make(chan struct{})
+	t.runs = make([]int, len(t.Tasks))
+	t.changes = make(changeSet)
+	t.parallel = newSemaphore(t.MaxParallel)
 	t.starter = make(chan struct{})
-	t.restarter = make(chan struct{})
-	t.twriters = NewTsonWriter(len(t.Tasks), t.writedelay, t.writeLog)
+	t.restarter = make(chan string)
+	t.taskRestarter = make(chan int)
+	t.taskReloader = make(chan map[int]*MasterTask)
+	t.ended = make(chan struct{})
+	t.forced = make(chan struct{})
+	t.force = sync.Once{}
+
+	// The writer after those of the MasterTasks is used by the teardown tasks.
+	t.twriters = NewTsonWriter(len(t.Tasks)+1, t.writedelay, t.writeLog)
 
 	if t.watcher != nil {
 		if err := t.watcher.Begin(); err != nil {
@@ -174,49 +523,298 @@ func (t *Tson) Start() error {
 
 	go t.manage()
 
-	t.starter <- struct{}{}
+	if t.schedule != nil {
+		go t.runSchedule()
+	} else {
+		t.starter <- struct{}{}
+	}
 
 	return nil
 }
 
+// runSchedule notifies the runner each time the schedule fires until the
+// runner ends.
+func (t *Tson) runSchedule() {
+	next := t.schedule.Next(time.Now())
+
+	for !next.IsZero() {
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-t.ended:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case t.scheduled <- struct{}{}:
+		case <-t.ended:
+			return
+		}
+
+		next = t.schedule.Next(next)
+		for !next.IsZero() && next.Before(time.Now()) {
+			next = t.schedule.Next(next)
+		}
+	}
+}
+
 // writeLog wrties the task output logs.
 func (t *Tson) writeLog(bu *bytes.Buffer) {
-	fmt.Fprint(t.Sink, bu.String())
+	out := maskSecrets(t.secrets, bu.String())
+
+	t.sinkl.Lock()
+	defer t.sinkl.Unlock()
+
+	fmt.Fprint(t.Sink, out)
+	t.feed.Write([]byte(out))
+
+	t.notify(func(o Observer) {
+		o.Log(t.ID(), out)
+	})
 }
 
-// startTasks restarts all tasks in the log.
-func (t *Tson) startTasks() {
+// startTasks starts all tasks in the log for the giving reason.
+func (t *Tson) startTasks(reason string) {
+	t.notify(func(o Observer) { o.RestartBegan(t.ID(), "", reason) })
+	defer t.notify(func(o Observer) { o.RestartEnded(t.ID(), "", reason) })
+
 	atomic.StoreInt64(&t.rebooting, 1)
 
-	for index, task := range t.Tasks {
-		go func(ind int, ts *MasterTask) {
-			wm := t.twriters.Writer(ind)
-			ts.Run(wm, wm)
-			t.singleRun <- struct{}{}
-		}(index, task)
+	changed := t.takeChanges()
+	for index := range t.Tasks {
+		t.runTask(index, changed)
 	}
 
 	atomic.StoreInt64(&t.rebooting, 0)
 }
 
-// restartTasks restarts all tasks in the log.
-func (t *Tson) restartTasks() {
+// restartTasks restarts all tasks in the log for the giving reason.
+func (t *Tson) restartTasks(reason string) {
+	t.notify(func(o Observer) { o.RestartBegan(t.ID(), "", reason) })
+	defer t.notify(func(o Observer) { o.RestartEnded(t.ID(), "", reason) })
+
 	atomic.StoreInt64(&t.rebooting, 1)
 	for index, task := range t.Tasks {
 		task.Stop(t.twriters.Writer(index))
 	}
 
-	for index, task := range t.Tasks {
-		go func(ind int, ts *MasterTask) {
-			wm := t.twriters.Writer(ind)
-			ts.Run(wm, wm)
-			t.singleRun <- struct{}{}
-		}(index, task)
+	changed := t.takeChanges()
+	for index := range t.Tasks {
+		t.runTask(index, changed)
 	}
 
 	atomic.StoreInt64(&t.rebooting, 0)
 }
 
+// restartTask restarts the task at the giving index.
+func (t *Tson) restartTask(index int) {
+	name := t.Tasks[index].Main.Name
+	t.notify(func(o Observer) { o.RestartBegan(t.ID(), name, ReasonRestart) })
+	defer t.notify(func(o Observer) { o.RestartEnded(t.ID(), name, ReasonRestart) })
+
+	t.Tasks[index].Stop(t.twriters.Writer(index))
+	t.runTask(index, nil)
+}
+
+// takeChanges returns the files changed since the tasks were last run.
+func (t *Tson) takeChanges() []string {
+	t.rm.Lock()
+	defer t.rm.Unlock()
+
+	return t.changes.take()
+}
+
+// runTask runs the task at the giving index as a new run for the giving
+// changed files, which replaces any earlier run of it. The run waits for a
+// free slot if the Tson or series limits the number of tasks running at once.
+// It must only be called by manage.
+func (t *Tson) runTask(index int, changed []string) {
+	t.rm.Lock()
+	t.runs[index]++
+	run := taskRun{index: index, gen: t.runs[index]}
+	t.rm.Unlock()
+
+	task := t.Tasks[index]
+	wm := t.twriters.Writer(index)
+
+	go func() {
+		if !t.parallel.acquire(t.ended) {
+			return
+		}
+		defer t.parallel.release()
+
+		var slots semaphore
+		if task.matrix != nil {
+			slots = task.matrix.slots
+		}
+
+		if !slots.acquire(t.ended) {
+			return
+		}
+		defer slots.release()
+
+		// Services run until stopped, so they would hold a job slot for good.
+		jobs := t.jobs
+		if task.Service {
+			jobs = nil
+		}
+
+		if !jobs.acquire(t.ended) {
+			return
+		}
+		defer jobs.release()
+
+		// A run replaced while waiting for a slot is dropped.
+		if t.currentRun(run) {
+			task.run(wm, wm, changed)
+		}
+
+		t.taskDone(run)
+	}()
+}
+
+// shutdown stops the MasterTasks in the reverse of their order, waiting for each
+// to end before stopping the next, and kills those still running once the stop
+// timeout passes. The teardown tasks are run once all have ended.
+func (t *Tson) shutdown() {
+	// Runs waiting for a slot are dropped.
+	t.rm.Lock()
+	for index := range t.runs {
+		t.runs[index]++
+	}
+	t.rm.Unlock()
+
+	abort := make(chan struct{})
+	timer := time.AfterFunc(t.stopTimeout, func() {
+		close(abort)
+	})
+
+	defer timer.Stop()
+
+	giveUp := make(chan struct{})
+	go func() {
+		select {
+		case <-abort:
+		case <-t.forced:
+		case <-t.ended:
+			return
+		}
+
+		close(giveUp)
+	}()
+
+	for index := len(t.Tasks) - 1; index >= 0; index-- {
+		mt := t.Tasks[index]
+		w := t.twriters.Writer(index)
+
+		mt.Stop(w)
+
+		if !mt.Wait(giveUp) {
+			select {
+			case <-t.forced:
+			default:
+				t.writeLog(bytes.NewBufferString(fmt.Sprintf("TSON Stop: killing %q after %s\n", mt.Main.Name, t.stopTimeout)))
+			}
+
+			mt.Kill(w)
+			mt.Wait(t.forced)
+		}
+	}
+
+	select {
+	case <-t.forced:
+		return
+	default:
+	}
+
+	if len(t.Teardown) == 0 {
+		return
+	}
+
+	t.writeLog(bytes.NewBufferString(fmt.Sprintf("TSON Teardown: %q\n", t.ID())))
+
+	for _, tk := range t.Teardown {
+		select {
+		case <-t.forced:
+			return
+		default:
+		}
+
+		tk.defaultTimeout = t.stopTimeout
+		tk.run(t.teardownWriter(), t.teardownWriter(), false, nil)
+	}
+
+	t.twriters.Wait()
+}
+
+// prepareTask sets up the giving task to run as part of the Tson, masking its
+// secrets and handing its events to the Tson.
+func (t *Tson) prepareTask(tk *Task) {
+	tk.secrets = t.secrets
+	tk.masked = t.masked
+	tk.owner = t
+}
+
+// taskStarted notifies observers that the command of the named task started.
+func (t *Tson) taskStarted(name string) {
+	t.notify(func(o Observer) { o.TaskStarted(t.ID(), name) })
+}
+
+// taskExited records the giving result of a run of a task into the stats log
+// and notifies observers of it.
+func (t *Tson) taskExited(res TaskResult) {
+	if t.Stats != nil {
+		if err := t.Stats.Record(t.ID(), res); err != nil {
+			t.writeLog(bytes.NewBufferString(fmt.Sprintf("TSON Stats: %s\n", err)))
+		}
+	}
+
+	t.notify(func(o Observer) { o.TaskExited(t.ID(), res) })
+}
+
+// taskSkipped notifies observers of the giving result of a skipped run of a
+// task, which is left out of the stats log.
+func (t *Tson) taskSkipped(res TaskResult) {
+	t.notify(func(o Observer) { o.TaskExited(t.ID(), res) })
+}
+
+// taskOutput notifies observers of the giving line of output of the named task.
+func (t *Tson) taskOutput(name string, line string) {
+	t.notify(func(o Observer) { o.Output(t.ID(), name, line) })
+}
+
+// teardownWriter returns the writer of the teardown tasks.
+func (t *Tson) teardownWriter() io.Writer {
+	return t.twriters.Writer(len(t.twriters.writers) - 1)
+}
+
+// masterTasks returns the MasterTasks of the Tson, which may be replaced when
+// it is reloaded.
+func (t *Tson) masterTasks() []*MasterTask {
+	t.rm.Lock()
+	defer t.rm.Unlock()
+
+	return append([]*MasterTask(nil), t.Tasks...)
+}
+
+// currentRun returns true/false if the giving run is the latest run of its task.
+func (t *Tson) currentRun(run taskRun) bool {
+	t.rm.Lock()
+	defer t.rm.Unlock()
+
+	return t.runs[run.index] == run.gen
+}
+
+// taskDone notifies the runner that the giving run of a task has finished.
+func (t *Tson) taskDone(run taskRun) {
+	select {
+	case t.singleRun <- run:
+	case <-t.ended:
+	}
+}
+
 // isBooting returns true/false if the task is rebooting.
 func (t *Tson) isBooting() bool {
 	return atomic.LoadInt64(&t.rebooting) == 1
@@ -224,11 +822,16 @@ func (t *Tson) isBooting() bool {
 
 // manage handles the managed of the operations of the tson task runner.
 func (t *Tson) manage() {
-	var totalDone int64
+	finished := make(map[int]bool)
 	totalTask := len(t.Tasks)
 
+	// running is true while any task is running and queued is true when a
+	// scheduled run waits for them to finish.
+	var running, queued bool
+
 	{
 		defer t.wg.Done()
+		defer close(t.ended)
 
 		for {
 			select {
@@ -241,31 +844,80 @@ func (t *Tson) manage() {
 				atomic.StoreInt64(&t.debounce, 1)
 
 			case <-t.starter:
-				t.startTasks()
+				running = true
+				t.startTasks(ReasonStart)
+
+			case <-t.scheduled:
+				switch {
+				case !running:
+					finished = make(map[int]bool)
+					running = true
+					t.startTasks(ReasonSchedule)
+				case t.Overlap == OverlapRestart:
+					finished = make(map[int]bool)
+					t.restartTasks(ReasonSchedule)
+				case t.Overlap == OverlapQueue:
+					queued = true
+				default:
+					t.writeLog(bytes.NewBufferString(fmt.Sprintf("TSON Schedule: skipped run of %q as tasks are still running\n", t.ID())))
+				}
+
+			case run := <-t.singleRun:
+				if !t.currentRun(run) {
+					continue
+				}
+
+				finished[run.index] = true
+
+				if group := t.Tasks[run.index].matrix; group != nil && group.done(finished) {
+					t.writeLog(bytes.NewBufferString(fmt.Sprintf("TSON Matrix %q: %s\n", group.name, group.status(t.Tasks))))
+				}
+
+				if len(finished) < totalTask {
+					continue
+				}
 
-			case <-t.singleRun:
-				atomic.AddInt64(&totalDone, 1)
+				running = false
 
-				done := int(atomic.LoadInt64(&totalDone))
+				if queued {
+					queued = false
+					finished = make(map[int]bool)
+					running = true
+					t.startTasks(ReasonSchedule)
+					continue
+				}
 
-				if done == totalTask && t.watcher == nil {
-					atomic.StoreInt64(&totalDone, 0)
+				if t.watcher == nil && t.schedule == nil {
+					finished = make(map[int]bool)
 
 					// Create goroutine to wait until write ends and then kill.
 					go func() {
 						t.twriters.Wait()
-						t.killer <- struct{}{}
+						t.Stop()
 					}()
 				}
 
-			case <-t.restarter:
-				t.restartTasks()
+			case reason := <-t.restarter:
+				finished = make(map[int]bool)
+				running = true
+				t.restartTasks(reason)
 
-			case <-t.killer:
-				for index, task := range t.Tasks {
-					task.Stop(t.twriters.Writer(index))
+			case index := <-t.taskRestarter:
+				delete(finished, index)
+				running = true
+				t.restartTask(index)
+
+			case mts := <-t.taskReloader:
+				running = true
+
+				for index, mt := range mts {
+					delete(finished, index)
+					t.reloadTask(index, mt)
 				}
 
+			case <-t.killer:
+				t.shutdown()
+
 				if t.ticker != nil {
 					t.ticker.Stop()
 				}
@@ -285,12 +937,14 @@ type WriteBlock interface {
 	Write([]byte) (int, error)
 }
 
-// TsonWriter defines a custom writer for the all tasks.
+// TsonWriter defines a custom writer for the all tasks, safe for use by the
+// goroutines of all tasks at once.
 type TsonWriter struct {
 	maxWriters int
 	wait       time.Duration
+	ml         sync.Mutex
 	ticker     *time.Timer
-	writers    []WriteBlock
+	writers    []*TickWriter
 	handler    func(*bytes.Buffer)
 	wg         sync.WaitGroup
 }
@@ -328,37 +982,44 @@ func (ts *TsonWriter) Wait() {
 
 // tick is called for all internal tson writers that have updates.
 func (ts *TsonWriter) tick(index int) {
-	if ts.ticker == nil {
-		ts.wg.Add(1)
-		ts.ticker = time.NewTimer(ts.wait)
-
-		go func() {
-			<-ts.ticker.C
+	ts.ml.Lock()
+	defer ts.ml.Unlock()
 
-			var bu bytes.Buffer
+	if ts.ticker != nil {
+		ts.ticker.Reset(ts.wait)
+		return
+	}
 
-			for _, bx := range ts.writers {
-				bu.Write(bx.Bytes())
-				bx.Reset()
-			}
+	ts.wg.Add(1)
+	ticker := time.NewTimer(ts.wait)
+	ts.ticker = ticker
 
-			ts.handler(&bu)
+	go func() {
+		<-ticker.C
 
-			ts.ticker = nil
-			ts.wg.Done()
-		}()
+		var bu bytes.Buffer
 
-		return
-	}
+		// Writes made once the ticker is cleared start a new one, so none
+		// are left in the writers unhandled.
+		ts.ml.Lock()
+		ts.ticker = nil
+		for _, bx := range ts.writers {
+			bu.Write(bx.take())
+		}
+		ts.ml.Unlock()
 
-	ts.ticker.Reset(ts.wait)
+		ts.handler(&bu)
+		ts.wg.Done()
+	}()
 }
 
 //==============================================================================
 
-// TickWriter defines a writer which calls a function for all writes.
+// TickWriter defines a writer which calls a function for all writes, safe for
+// use by many goroutines.
 type TickWriter struct {
 	*bytes.Buffer
+	ml     sync.Mutex
 	index  int
 	ticker func(int)
 }
@@ -375,7 +1036,9 @@ func NewTickWriter(index int, ticker func(int)) *TickWriter {
 // Write calls the tickWriter ticker function after writing to update the
 // handler of a write.
 func (t *TickWriter) Write(bu []byte) (int, error) {
+	t.ml.Lock()
 	n, err := t.Buffer.Write(bu)
+	t.ml.Unlock()
 
 	if t.ticker != nil {
 		t.ticker(t.index)
@@ -383,3 +1046,30 @@ func (t *TickWriter) Write(bu []byte) (int, error) {
 
 	return n, err
 }
+
+// Bytes returns a copy of the unread bytes of the writer.
+func (t *TickWriter) Bytes() []byte {
+	t.ml.Lock()
+	defer t.ml.Unlock()
+
+	return append([]byte(nil), t.Buffer.Bytes()...)
+}
+
+// Reset empties the writer.
+func (t *TickWriter) Reset() {
+	t.ml.Lock()
+	defer t.ml.Unlock()
+
+	t.Buffer.Reset()
+}
+
+// take returns the unread bytes of the writer and empties it.
+func (t *TickWriter) take() []byte {
+	t.ml.Lock()
+	defer t.ml.Unlock()
+
+	bu := append([]byte(nil), t.Buffer.Bytes()...)
+	t.Buffer.Reset()
+
+	return bu
+}
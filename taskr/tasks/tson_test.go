@@ -2,6 +2,13 @@ package tasks_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -25,3 +32,736 @@ func TestTsonWriter(t *testing.T) {
 
 	ws.Wait()
 }
+
+func TestTsonControls(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	var buf syncBuffer
+	var tson tasks.Tson
+
+	tson.Sink = &buf
+	tson.Name = "sleepers"
+	tson.WriteDelay = "10ms"
+	tson.Tasks = []*tasks.MasterTask{
+		{
+			Main: rec.task("Sleeper", "block"),
+		},
+	}
+
+	series := tasks.New(&tson)
+	if err := series.Start(); err != nil {
+		t.Fatalf("\tFailed: \t Error occurred in start series: %q", err.Error())
+	}
+
+	waitFor(t, "main task to start", func() bool { return rec.count("Sleeper") == 1 })
+
+	status := series.Status()
+	if len(status) != 1 || status[0].Name != "sleepers" {
+		t.Fatalf("Should have status for named tson: %+v", status)
+	}
+
+	if status[0].Tasks[0].Main.Status != tasks.StatusRunning {
+		t.Fatalf("Should have main task running: %+v", status[0].Tasks[0].Main)
+	}
+
+	series.Pause()
+	if !series.Status()[0].Paused {
+		t.Fatal("Should have paused tson")
+	}
+
+	if err := series.Restart("Sleeper"); err != nil {
+		t.Fatalf("Should have restarted task: %q", err.Error())
+	}
+
+	if err := series.Restart("Missing"); err != tasks.ErrNotFound {
+		t.Fatalf("Should have failed to find missing task: %v", err)
+	}
+
+	series.Stop()
+	series.Wait()
+}
+
+func TestTsonLimits(t *testing.T) {
+	sleeper := func(name string, lock string) *tasks.MasterTask {
+		return &tasks.MasterTask{
+			Main: &tasks.Task{
+				Name:       name,
+				Command:    "sleep",
+				Parameters: []string{"0.2"},
+				Lock:       lock,
+			},
+		}
+	}
+
+	var buf syncBuffer
+
+	parallel := &tasks.Tson{
+		Sink:        &buf,
+		Name:        "parallel",
+		WriteDelay:  "10ms",
+		MaxParallel: 1,
+		Tasks:       []*tasks.MasterTask{sleeper("First", ""), sleeper("Second", "")},
+	}
+
+	locked := &tasks.Tson{
+		Sink:       &buf,
+		Name:       "locked",
+		WriteDelay: "10ms",
+		Tasks:      []*tasks.MasterTask{sleeper("Migrate", "db"), sleeper("Seed", "db")},
+	}
+
+	series := tasks.New(parallel, locked)
+	if err := series.Start(); err != nil {
+		t.Fatalf("\tFailed: \t Error occurred in start series: %q", err.Error())
+	}
+
+	series.Wait()
+
+	for _, tson := range series.Tasks {
+		first := tson.Tasks[0].Main.Result()
+		second := tson.Tasks[1].Main.Result()
+
+		if first.Status != tasks.StatusDone || second.Status != tasks.StatusDone {
+			t.Fatalf("Should have completed tasks of %q: %+v %+v", tson.Name, first, second)
+		}
+
+		if first.Started.Before(second.Ended) && second.Started.Before(first.Ended) {
+			t.Fatalf("Should not have run tasks of %q at the same time: %+v %+v", tson.Name, first, second)
+		}
+	}
+}
+
+func TestTsonJobsServices(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	var buf syncBuffer
+
+	series := tasks.New(&tasks.Tson{
+		Name:       "services",
+		Sink:       &buf,
+		WriteDelay: "10ms",
+		Tasks: []*tasks.MasterTask{
+			{Main: rec.task("web", "block"), Service: true},
+			{Main: rec.task("worker", "block"), Service: true},
+		},
+	}, &tasks.Tson{
+		Name:       "builds",
+		Sink:       &buf,
+		WriteDelay: "10ms",
+		Tasks: []*tasks.MasterTask{
+			{Main: rec.task("compile")},
+			{Main: rec.task("lint")},
+		},
+	})
+
+	series.Jobs = 1
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	defer func() {
+		series.Stop()
+		series.Wait()
+	}()
+
+	// Services keep running, so only they would ever run if they held jobs.
+	builds := series.Tsons()[1]
+	first := builds.Tasks[0].Main
+	second := builds.Tasks[1].Main
+
+	waitFor(t, "tasks next to services", func() bool {
+		return rec.count("web") == 1 && rec.count("worker") == 1 &&
+			first.Result().Status == tasks.StatusDone && second.Result().Status == tasks.StatusDone
+	})
+
+	if a, b := first.Result(), second.Result(); a.Started.Before(b.Ended) && b.Started.Before(a.Ended) {
+		t.Fatalf("Should have run tasks which are not services one at a time: %+v %+v", a, b)
+	}
+}
+
+func TestTsonStopWaitingForLock(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	holder := rec.task("holder", "block")
+	holder.Lock = "lock:" + t.Name()
+
+	waiter := rec.task("waiter")
+	waiter.Lock = holder.Lock
+
+	var buf syncBuffer
+
+	go holder.Run(&buf, &buf)
+	defer holder.Stop(&buf)
+
+	waitFor(t, "holder to run", func() bool { return holder.State() == tasks.StateRunning })
+
+	series := tasks.New(&tasks.Tson{
+		Name:       "locked",
+		Sink:       &buf,
+		WriteDelay: "10ms",
+		Tasks:      []*tasks.MasterTask{{Main: waiter}},
+	})
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	waitFor(t, "waiter to wait for lock", func() bool { return strings.Contains(buf.String(), "Waiting For Lock") })
+
+	stopped := make(chan struct{})
+	go func() {
+		series.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Should have stopped task waiting for lock")
+	}
+
+	if res := waiter.Result(); res.Status != tasks.StatusStopped || rec.count("waiter") != 0 {
+		t.Fatalf("Should have stopped waiter without running it: %+v", res)
+	}
+}
+
+func TestTsonMatrix(t *testing.T) {
+	var buf bytes.Buffer
+
+	tson := tasks.Tson{
+		Sink:       &buf,
+		Name:       "matrix",
+		WriteDelay: "10ms",
+		Tasks: []*tasks.MasterTask{
+			{
+				Matrix: map[string][]string{
+					"GOOS":   {"linux", "darwin"},
+					"GOARCH": {"amd64", "arm64"},
+				},
+				MatrixParallel: 1,
+				Main: &tasks.Task{
+					Name:       "Build",
+					Command:    "sh",
+					Parameters: []string{"-c", "test ${GOOS}/${GOARCH} = $GOOS/$GOARCH && sleep 0.05"},
+				},
+			},
+		},
+	}
+
+	if err := tson.Start(); err != nil {
+		t.Fatalf("\tFailed: \t Error occurred in start tson: %q", err.Error())
+	}
+
+	tson.Wait()
+
+	if len(tson.Tasks) != 4 {
+		t.Fatalf("Should have expanded matrix into 4 tasks: %d", len(tson.Tasks))
+	}
+
+	if name := tson.Tasks[0].Main.Name; name != "Build [GOARCH=amd64 GOOS=linux]" {
+		t.Fatalf("Should have named expanded task after its values: %q", name)
+	}
+
+	results := make([]tasks.TaskResult, len(tson.Tasks))
+	for index, mt := range tson.Tasks {
+		results[index] = mt.Main.Result()
+	}
+
+	for index, res := range results {
+		if res.Status != tasks.StatusDone {
+			t.Fatalf("Should have completed expanded task: %+v", res)
+		}
+
+		for _, other := range results[index+1:] {
+			if res.Started.Before(other.Ended) && other.Started.Before(res.Ended) {
+				t.Fatalf("Should not have run expanded tasks at the same time: %+v %+v", res, other)
+			}
+		}
+	}
+
+	status := tson.Status()
+	if len(status.Matrices) != 1 || status.Matrices[0].Counts[tasks.StatusDone] != 4 {
+		t.Fatalf("Should have summarised matrix results: %+v", status.Matrices)
+	}
+
+	if !strings.Contains(buf.String(), `TSON Matrix "Build": 4 tasks: 4 done`) {
+		t.Fatalf("Should have logged matrix summary: %q", buf.String())
+	}
+}
+
+func TestTsonMatrixInteractive(t *testing.T) {
+	series := tasks.New(&tasks.Tson{
+		Name: "matrix",
+		Tasks: []*tasks.MasterTask{{
+			Matrix: map[string][]string{"GOOS": {"linux", "darwin"}},
+			Main:   &tasks.Task{Name: "Shell", Command: "sh", Interactive: true},
+		}},
+	})
+
+	if err := series.Start(); err != tasks.ErrManyInteractive {
+		t.Fatalf("Should have refused interactive main task with a matrix: %v", err)
+	}
+}
+
+func TestTsonMatrixBuiltin(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf syncBuffer
+
+	tson := tasks.Tson{
+		Sink:       &buf,
+		Name:       "dirs",
+		WriteDelay: "10ms",
+		Tasks: []*tasks.MasterTask{{
+			Matrix: map[string][]string{"DIR": {"public", "private"}},
+			Main:   &tasks.Task{Name: "Mkdir", Type: tasks.TypeMkdir, Parameters: []string{filepath.Join(dir, "${DIR}")}},
+		}},
+	}
+
+	if err := tson.Start(); err != nil {
+		t.Fatalf("Should have started tson: %q", err.Error())
+	}
+
+	tson.Wait()
+
+	for _, name := range []string{"public", "private"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || !info.IsDir() {
+			t.Fatalf("Should have run built-in task for each combination: %q", buf.String())
+		}
+	}
+}
+
+func TestTsonPlan(t *testing.T) {
+	tson := tasks.Tson{
+		Name:    "plan",
+		Timeout: "5m",
+		Tasks: []*tasks.MasterTask{
+			{
+				MaxRunTime: "30s",
+				Matrix:     map[string][]string{"GOOS": {"linux", "darwin"}},
+				Before:     []*tasks.Task{{Name: "Clean", Type: tasks.TypeRemove, Parameters: []string{"bin/${GOOS}"}}},
+				Main:       &tasks.Task{Name: "Build", Command: "go", Parameters: []string{"build", "-o", "bin/${GOOS}/my app"}},
+			},
+		},
+	}
+
+	plan, err := tson.Plan()
+	if err != nil {
+		t.Fatalf("Should have planned tson: %q", err.Error())
+	}
+
+	if len(plan.Tasks) != 2 || plan.Tasks[0].Matrix != "Build" {
+		t.Fatalf("Should have planned each matrix combination: %+v", plan.Tasks)
+	}
+
+	steps := plan.Tasks[0].Tasks
+	if len(steps) != 2 || steps[0].Stage != tasks.StageBefore || steps[1].Step != 2 {
+		t.Fatalf("Should have planned tasks in order: %+v", steps)
+	}
+
+	if steps[0].CommandLine != "remove bin/linux" || steps[0].Timeout != "30s" {
+		t.Fatalf("Should have resolved before task: %+v", steps[0])
+	}
+
+	if steps[1].CommandLine != `go build -o "bin/linux/my app"` || steps[1].Timeout != "5m" || steps[1].Env["GOOS"] != "linux" {
+		t.Fatalf("Should have resolved main task: %+v", steps[1])
+	}
+
+	if len(tson.Tasks) != 1 || tson.Tasks[0].Main.Result().Status != tasks.StatusPending {
+		t.Fatal("Should not have changed or run the tson's tasks")
+	}
+
+	tson.Schedule = "@often"
+	if _, err := tson.Plan(); err == nil {
+		t.Fatal("Should have rejected invalid schedule")
+	}
+}
+
+func TestTsonSeriesOneShot(t *testing.T) {
+	once := &tasks.Tson{Name: "once"}
+	series := tasks.New(once)
+
+	if !series.OneShot() {
+		t.Fatal("Should run once without files or schedule")
+	}
+
+	series = tasks.New(once, &tasks.Tson{Name: "watch", Files: []string{"."}})
+	if series.OneShot() {
+		t.Fatal("Should not run once when a tson watches files")
+	}
+
+	series = tasks.New(once, &tasks.Tson{Name: "nightly", Schedule: "@daily"})
+	if series.OneShot() {
+		t.Fatal("Should not run once when a tson runs on a schedule")
+	}
+}
+
+func TestTsonSeriesReload(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	var buf syncBuffer
+
+	tson := func(name string, mts ...*tasks.MasterTask) *tasks.Tson {
+		return &tasks.Tson{Name: name, Sink: &buf, WriteDelay: "10ms", Tasks: mts}
+	}
+
+	main := func(name string, params ...string) *tasks.MasterTask {
+		return &tasks.MasterTask{Main: rec.task(name, params...)}
+	}
+
+	series := tasks.New(
+		tson("web", main("api", "block"), main("worker", "block")),
+		tson("docs", main("site", "block")),
+	)
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	waitFor(t, "tasks to start", func() bool { return len(rec.runs()) == 3 })
+
+	invalid := tson("web", main("api", "block"))
+	invalid.Schedule = "@often"
+
+	if _, err := series.Reload([]*tasks.Tson{invalid}); err == nil {
+		t.Fatal("Should have rejected invalid tson")
+	}
+
+	if len(series.Tsons()) != 2 || rec.count("api") != 1 {
+		t.Fatal("Should have kept running tsons after invalid reload")
+	}
+
+	result, err := series.Reload([]*tasks.Tson{
+		tson("web", main("api", "block"), main("worker", "queue", "block")),
+		tson("lint", main("vet", "block")),
+	})
+
+	if err != nil {
+		t.Fatalf("Should have reloaded series: %q", err.Error())
+	}
+
+	if strings.Join(result.Tasks, ",") != "web/worker" || strings.Join(result.Started, ",") != "lint" || strings.Join(result.Stopped, ",") != "docs" || len(result.Restarted) != 0 {
+		t.Fatalf("Should have applied only changes: %s", result)
+	}
+
+	waitFor(t, "changed task to restart", func() bool { return rec.count("worker") == 2 && rec.count("vet") == 1 })
+
+	if rec.count("api") != 1 {
+		t.Fatal("Should have left unchanged task running")
+	}
+
+	changed := tson("web", main("api", "block"), main("worker", "queue", "block"))
+	changed.MaxParallel = 2
+
+	if result, err = series.Reload([]*tasks.Tson{changed, tson("lint", main("vet", "block"))}); err != nil {
+		t.Fatalf("Should have reloaded series: %q", err.Error())
+	}
+
+	if strings.Join(result.Restarted, ",") != "web" || len(result.Tasks) != 0 {
+		t.Fatalf("Should have restarted tson with changed settings: %s", result)
+	}
+
+	waitFor(t, "tson to restart", func() bool { return rec.count("api") == 2 })
+
+	series.Stop()
+	series.Wait()
+}
+
+func TestTsonSeriesReloadFailure(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	var buf syncBuffer
+
+	tson := func(name string, mts ...*tasks.MasterTask) *tasks.Tson {
+		return &tasks.Tson{Name: name, Sink: &buf, WriteDelay: "10ms", Tasks: mts}
+	}
+
+	main := func(name string, params ...string) *tasks.MasterTask {
+		return &tasks.MasterTask{Main: rec.task(name, params...)}
+	}
+
+	series := tasks.New(tson("web", main("api", "block")), tson("docs", main("site", "block")))
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	waitFor(t, "tasks to start", func() bool { return len(rec.runs()) == 2 })
+
+	broken := tson("web", main("api", "block"))
+	broken.WriteDelay = "soon"
+
+	if _, err := series.Reload([]*tasks.Tson{tson("lint", main("vet", "block")), broken}); err == nil {
+		t.Fatal("Should have failed to start tson")
+	}
+
+	waitFor(t, "started tson to run", func() bool { return rec.count("vet") == 1 })
+
+	var names []string
+	for _, tson := range series.Tsons() {
+		names = append(names, tson.ID())
+	}
+
+	if strings.Join(names, ",") != "lint,docs" {
+		t.Fatalf("Should have kept running tsons in series: %q", names)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		series.Stop()
+		series.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Should have stopped tsons started by failed reload")
+	}
+
+	if _, err := series.Reload([]*tasks.Tson{tson("lint", main("vet", "block"))}); err != tasks.ErrStopping {
+		t.Fatalf("Should have refused reload of stopped series: %v", err)
+	}
+
+	if rec.count("vet") != 1 {
+		t.Fatal("Should not have started tsons after stop")
+	}
+}
+
+func TestTsonStopAndTeardown(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	var buf syncBuffer
+
+	tson := &tasks.Tson{
+		Name:       "db",
+		Sink:       &buf,
+		WriteDelay: "10ms",
+		Tasks: []*tasks.MasterTask{
+			{Main: rec.task("api", "block")},
+			{Main: rec.task("worker", "block")},
+		},
+		Teardown: []*tasks.Task{
+			rec.task("dump", "dumped"),
+			rec.task("down", "stopped"),
+		},
+	}
+
+	series := tasks.New(tson, &tasks.Tson{
+		Name:       "web",
+		Sink:       &buf,
+		WriteDelay: "10ms",
+		Tasks:      []*tasks.MasterTask{{Main: rec.task("site", "block")}},
+	})
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	waitFor(t, "tasks to start", func() bool { return len(rec.runs()) == 3 })
+
+	series.Stop()
+	series.Wait()
+
+	if ends := strings.Join(rec.ends(), ","); ends != "site,worker,api,dump,down" {
+		t.Fatalf("Should have stopped in reverse order before tearing down: %s", ends)
+	}
+
+	if output := buf.String(); !strings.Contains(output, "dumped") || !strings.Contains(output, "stopped") {
+		t.Fatalf("Should have written teardown output: %q", output)
+	}
+}
+
+func TestTsonStopTimeout(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	var buf syncBuffer
+
+	tson := &tasks.Tson{
+		Name:        "db",
+		Sink:        &buf,
+		WriteDelay:  "10ms",
+		StopTimeout: "50ms",
+		Tasks:       []*tasks.MasterTask{{Main: rec.task("server", "stubborn")}},
+		Teardown:    []*tasks.Task{rec.task("down")},
+	}
+
+	if err := tson.Start(); err != nil {
+		t.Fatalf("Should have started tson: %q", err.Error())
+	}
+
+	waitFor(t, "task to start", func() bool { return rec.count("server") == 1 })
+
+	tson.Stop()
+	tson.Wait()
+
+	if ends := strings.Join(rec.ends(), ","); ends != "server,down" {
+		t.Fatalf("Should have killed task before tearing down: %s", ends)
+	}
+
+	if !strings.Contains(buf.String(), "killing") {
+		t.Fatalf("Should have logged killing task: %q", buf.String())
+	}
+}
+
+func TestTsonSecrets(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	t.Setenv("TASKR_TEST_DSN", "postgres://admin:hunter2@db")
+
+	data := fmt.Sprintf(`{
+	  "name": "api",
+	  "write_delay": "10ms",
+	  "secrets": ["TASKR_TEST_DSN"],
+	  "tasks": [{
+	    "main": {
+	      "name": "deploy",
+	      "type": %q,
+	      "params": ["token=s3cr3t-token", "dsn=postgres://admin:hunter2@db", "region=eu"],
+	      "env": {"TOKEN": {"value": "s3cr3t-token", "secret": true}, "REGION": "eu"}
+	    }
+	  }]
+	}`, rec.kind)
+
+	var buf syncBuffer
+
+	tson := &tasks.Tson{Sink: &buf}
+	if err := json.Unmarshal([]byte(data), tson); err != nil {
+		t.Fatalf("Should have decoded tson: %q", err.Error())
+	}
+
+	main := tson.Tasks[0].Main
+	if main.Env["TOKEN"] != "s3cr3t-token" || main.Env["REGION"] != "eu" || strings.Join(main.Secrets, ",") != "TOKEN" {
+		t.Fatalf("Should have decoded secret env: %+v %q", main.Env, main.Secrets)
+	}
+
+	plan, err := tson.Plan()
+	if err != nil {
+		t.Fatalf("Should have planned tson: %q", err.Error())
+	}
+
+	step := plan.Tasks[0].Tasks[0]
+	if strings.Contains(step.CommandLine, "s3cr3t") || strings.Contains(step.CommandLine, "hunter2") || step.Env["TOKEN"] != "********" || step.Env["REGION"] != "eu" {
+		t.Fatalf("Should have masked secrets in plan: %q %+v", step.CommandLine, step.Env)
+	}
+
+	if main.Env["TOKEN"] != "s3cr3t-token" {
+		t.Fatal("Should not have masked the env of the task")
+	}
+
+	if err := tson.Start(); err != nil {
+		t.Fatalf("Should have started tson: %q", err.Error())
+	}
+
+	tson.Wait()
+
+	output := buf.String()
+	if strings.Contains(output, "s3cr3t") || strings.Contains(output, "hunter2") {
+		t.Fatalf("Should have masked secrets in output: %q", output)
+	}
+
+	if !strings.Contains(output, "token=********") || !strings.Contains(output, "region=eu") {
+		t.Fatalf("Should have written masked output: %q", output)
+	}
+}
+
+func TestTsonSecretsSplitAcrossWrites(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Pseudo-terminals are only supported on linux")
+	}
+
+	for _, interactive := range []bool{false, true} {
+		var buf, term syncBuffer
+
+		// The secret is written in two chunks, with a flush of the Tson's
+		// writers between them, where no part of it may be written.
+		split := &tasks.Task{
+			Name:        "split",
+			Command:     "sh",
+			Parameters:  []string{"-c", `printf "%s" "$HEAD"; sleep 0.1; printf "%s done\n" "$TAIL"`},
+			Env:         map[string]string{"TOKEN": "token-s3cr3t", "HEAD": "tok", "TAIL": "en-s3cr3t"},
+			Secrets:     []string{"TOKEN"},
+			TTY:         true,
+			Interactive: interactive,
+			Input:       strings.NewReader(""),
+			Terminal:    &term,
+		}
+
+		tson := &tasks.Tson{Name: "split", Sink: &buf, WriteDelay: "10ms", Tasks: []*tasks.MasterTask{{Main: split}}}
+		if err := tson.Start(); err != nil {
+			t.Fatalf("Should have started tson: %q", err.Error())
+		}
+
+		tson.Wait()
+
+		output := buf.String()
+		if interactive {
+			output = term.String()
+		}
+
+		if strings.Contains(output, "tok") || !strings.Contains(output, "******** done") {
+			t.Fatalf("Should have masked secret split across writes (interactive %t): %q", interactive, output)
+		}
+	}
+}
+
+func TestTsonEventsFilter(t *testing.T) {
+	rec := newFakeRecorder(t)
+
+	dir := t.TempDir()
+
+	gated := rec.task("gated")
+	gated.If = &tasks.Condition{Changed: filepath.Join(dir, "created.txt")}
+
+	var buf syncBuffer
+
+	series := tasks.New(&tasks.Tson{
+		Name:          "removals",
+		Sink:          &buf,
+		WriteDelay:    "10ms",
+		DebounceDelay: "10ms",
+		Events:        "REMOVE",
+		Files:         []string{dir},
+		Tasks:         []*tasks.MasterTask{{Main: gated}},
+	})
+
+	var events eventRecorder
+	series.Observe(&events)
+
+	if err := series.Start(); err != nil {
+		t.Fatalf("Should have started series: %q", err.Error())
+	}
+
+	defer func() {
+		series.Stop()
+		series.Wait()
+	}()
+
+	waitFor(t, "first run", func() bool { return len(events.list("task:removals:gated:")) == 1 })
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "created.txt"), nil, 0644); err != nil {
+		t.Fatalf("Should have written file: %q", err.Error())
+	}
+
+	// Removals caught by the debounce of the watcher are dropped, so files
+	// are removed until one restarts the tasks.
+	removed := filepath.Join(dir, "removed.txt")
+	waitFor(t, "restart on removal", func() bool {
+		ioutil.WriteFile(removed, nil, 0644)
+		os.Remove(removed)
+
+		return len(events.list("task:removals:gated:")) > 1
+	})
+
+	for _, file := range events.list("file:") {
+		if file != "file:removals:removed.txt" {
+			t.Fatalf("Should have only observed removals: %+q", events.list("file:"))
+		}
+	}
+
+	if res := gated.Result(); res.Status != tasks.StatusSkipped {
+		t.Fatalf("Should not have counted unwatched events as changes: %+v", res)
+	}
+}
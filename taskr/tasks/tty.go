@@ -0,0 +1,148 @@
+package tasks
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ptyDrainWait sets the maximum time to wait for output still held by a
+// pseudo-terminal after its command has exited, since children of the command
+// may keep the terminal open.
+const ptyDrainWait = 2 * time.Second
+
+// ptyInputPoll sets how often the input copy of a pseudo-terminal checks
+// whether it was stopped while no input is waiting.
+const ptyInputPoll = 100 * time.Millisecond
+
+// ptyStream connects a command to a pseudo-terminal, streaming the raw bytes
+// it writes to the terminal into a writer without splitting them into lines,
+// which keeps colours and carriage-return progress bars intact.
+type ptyStream struct {
+	master     *os.File
+	slave      *os.File
+	out        io.Writer
+	in         io.Reader
+	restore    func()
+	stopResize func()
+	stopInput  chan struct{}
+	inputDone  chan struct{}
+	done       chan struct{}
+}
+
+// newPTYStream returns a new ptyStream for the giving command, setting the
+// pseudo-terminal as the command's standard input and outputs. If in is not
+// nil, it's content is forwarded into the terminal.
+func newPTYStream(cmd *exec.Cmd, out io.Writer, in io.Reader) (*ptyStream, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	copyWinsize(master)
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	cmd.SysProcAttr = ptyAttrs()
+
+	return &ptyStream{
+		master:    master,
+		slave:     slave,
+		out:       out,
+		in:        in,
+		restore:   func() {},
+		stopInput: make(chan struct{}),
+		inputDone: make(chan struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Begin starts streaming the terminal output, it must be called once the
+// command has started.
+func (p *ptyStream) Begin() {
+	p.slave.Close()
+	p.stopResize = watchWinsize(p.master)
+
+	if fl, ok := p.in.(*os.File); ok {
+		p.restore = makeRaw(fl)
+
+		go func() {
+			defer close(p.inputDone)
+			copyInput(p.master, fl, p.stopInput)
+		}()
+	} else {
+		close(p.inputDone)
+
+		// The input copy ends on the next read after the terminal is closed.
+		if p.in != nil {
+			go io.Copy(p.master, p.in)
+		}
+	}
+
+	go func() {
+		defer close(p.done)
+
+		// Reads from the master end with an error once the command has
+		// exited, which is expected.
+		io.Copy(p.out, p.master)
+	}()
+}
+
+// Abort releases the terminal when the command failed to start.
+func (p *ptyStream) Abort() {
+	p.slave.Close()
+	p.master.Close()
+}
+
+// End waits for the remaining terminal output and releases the terminal, it
+// must be called once the command has exited.
+func (p *ptyStream) End() {
+	select {
+	case <-p.done:
+	case <-time.After(ptyDrainWait):
+	}
+
+	p.stopResize()
+	close(p.stopInput)
+	p.master.Close()
+	<-p.inputDone
+	p.restore()
+}
+
+// copyInput copies the giving input into the terminal until stop is closed. It
+// only reads once input is waiting, so no read outlives the copy and takes the
+// input meant for the task run after it, e.g from os.Stdin.
+func copyInput(master *os.File, in *os.File, stop chan struct{}) {
+	fd := in.Fd()
+	buf := make([]byte, 32*1024)
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		ready, err := waitInput(fd, ptyInputPoll)
+		if err != nil {
+			return
+		}
+
+		if !ready {
+			continue
+		}
+
+		n, err := in.Read(buf)
+		if n > 0 {
+			if _, err := master.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package tasks
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS returns the peak resident memory in bytes of the process which ended
+// with the giving state, which linux reports in kilobytes.
+func maxRSS(ps *os.ProcessState) int64 {
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		return ru.Maxrss * 1024
+	}
+
+	return 0
+}
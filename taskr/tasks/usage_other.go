@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package tasks
+
+import "os"
+
+// maxRSS returns 0 as the peak resident memory of processes is only read on
+// linux, where its unit is known.
+func maxRSS(ps *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/influx6/clis/taskr/tasks"
+)
+
+// templates holds the built-in templates of taskr init by name.
+var templates = map[string]string{
+	"default": `[{
+  "desc": "Example description",
+  "write_delay": "20ms",
+  "debounce_delay": "5s",
+  "tasks": [{
+    "max_runtime": "1m",
+    "main": {
+      "name": "Sample",
+      "command":"echo",
+      "params": ["Sample"],
+      "desc": "Sample main task"
+    },
+    "before":[],
+    "after":[]
+  }]
+}]
+`,
+
+	"go-web": `[{
+  "name": "server",
+  "desc": "Rebuilds and restarts the server when go files change",
+  "files_glob": ["./*.go", "./*/*.go"],
+  "write_delay": "20ms",
+  "debounce_delay": "500ms",
+  "tasks": [{
+    "max_runtime": "2m",
+    "before": [{
+      "name": "Vet",
+      "command": "go",
+      "params": ["vet", "./..."],
+      "desc": "Checks the code for mistakes"
+    }, {
+      "name": "Build",
+      "command": "go",
+      "params": ["build", "-o", "bin/server", "."],
+      "desc": "Builds the server"
+    }],
+    "main": {
+      "name": "Server",
+      "command": "./bin/server",
+      "desc": "Runs the server"
+    }
+  }]
+}]
+`,
+
+	"gopherjs": `[{
+  "name": "client",
+  "desc": "Rebuilds the gopherjs client when its go files change",
+  "files_glob": ["./client/*.go"],
+  "write_delay": "20ms",
+  "debounce_delay": "500ms",
+  "tasks": [{
+    "main": {
+      "name": "Client",
+      "command": "gopherjs",
+      "params": ["build", "-o", "static/js/app.js", "./client"],
+      "desc": "Compiles the client into javascript"
+    }
+  }]
+}, {
+  "name": "server",
+  "desc": "Rebuilds and restarts the server when its go files change",
+  "files_glob": ["./*.go"],
+  "write_delay": "20ms",
+  "debounce_delay": "500ms",
+  "tasks": [{
+    "before": [{
+      "name": "Build",
+      "command": "go",
+      "params": ["build", "-o", "bin/server", "."],
+      "desc": "Builds the server"
+    }],
+    "main": {
+      "name": "Server",
+      "command": "./bin/server",
+      "desc": "Runs the server serving the compiled client"
+    }
+  }]
+}]
+`,
+
+	"node": `[{
+  "name": "app",
+  "desc": "Restarts the app when its sources change",
+  "files_glob": ["./*.js", "./src/*.js", "./package.json"],
+  "write_delay": "20ms",
+  "debounce_delay": "500ms",
+  "tasks": [{
+    "before": [{
+      "name": "Install",
+      "command": "npm",
+      "params": ["install"],
+      "desc": "Installs dependencies when missing",
+      "if": {"exists": "node_modules", "not": true}
+    }],
+    "main": {
+      "name": "Start",
+      "command": "npm",
+      "params": ["start"],
+      "desc": "Runs the app"
+    }
+  }]
+}]
+`,
+
+	"static-site": `[{
+  "name": "site",
+  "desc": "Serves the site in public",
+  "write_delay": "20ms",
+  "tasks": [{
+    "main": {
+      "name": "Serve",
+      "type": "serve",
+      "params": ["public", "localhost:8080"],
+      "desc": "Serves the files of public"
+    }
+  }]
+}]
+`,
+}
+
+// templateDir returns the directory holding user templates, which are json
+// files named after the template, e.g go-web.json.
+func templateDir() (string, error) {
+	if dir := os.Getenv("TASKR_TEMPLATES"); dir != "" {
+		return dir, nil
+	}
+
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(config, "taskr", "templates"), nil
+}
+
+// templateName matches the names templates may have, which keeps a name from
+// reaching files outside the template directory.
+var templateName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// loadTemplate returns the named template, looking in the user templates before
+// the built-in ones, and validates it as a tasks file.
+func loadTemplate(name string) ([]byte, error) {
+	if !templateName.MatchString(name) {
+		return nil, fmt.Errorf("Invalid template name %q, expected only letters, digits, - and _", name)
+	}
+
+	if dir, err := templateDir(); err == nil {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name+".json"))
+		if err == nil {
+			var tsons []*tasks.Tson
+			if err := json.Unmarshal(data, &tsons); err != nil {
+				return nil, fmt.Errorf("Template %q is not a valid tasks file: %s", name, err)
+			}
+
+			return data, nil
+		}
+
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	tmpl, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown template %q, expected one of %s", name, strings.Join(templateNames(), ", "))
+	}
+
+	return []byte(tmpl), nil
+}
+
+// templateNames returns the names of the built-in and user templates.
+func templateNames() []string {
+	seen := make(map[string]bool)
+	for name := range templates {
+		seen[name] = true
+	}
+
+	if dir, err := templateDir(); err == nil {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		for _, file := range files {
+			if name := strings.TrimSuffix(filepath.Base(file), ".json"); templateName.MatchString(name) {
+				seen[name] = true
+			}
+		}
+	}
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// detectTemplate returns the name of the template suiting the project in the
+// giving directory, from its go.mod, package.json or public/index.html.
+func detectTemplate(dir string) string {
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		if strings.Contains(string(data), "gopherjs") {
+			return "gopherjs"
+		}
+
+		return "go-web"
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+		return "node"
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "public", "index.html")); err == nil {
+		return "static-site"
+	}
+
+	return "default"
+}
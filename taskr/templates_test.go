@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTemplate(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TASKR_TEMPLATES", dir)
+
+	if data, err := loadTemplate("go-web"); err != nil || !strings.Contains(string(data), `"server"`) {
+		t.Fatalf("Should have loaded built-in template: %v", err)
+	}
+
+	custom := `[{"name": "api", "tasks": []}]`
+	if err := ioutil.WriteFile(filepath.Join(dir, "go-web.json"), []byte(custom), 0644); err != nil {
+		t.Fatalf("Should have written template: %q", err.Error())
+	}
+
+	if data, err := loadTemplate("go-web"); err != nil || string(data) != custom {
+		t.Fatalf("Should have preferred user template: %q %v", data, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatalf("Should have written template: %q", err.Error())
+	}
+
+	if _, err := loadTemplate("broken"); err == nil {
+		t.Fatalf("Should have refused invalid template")
+	}
+
+	if _, err := loadTemplate("missing"); err == nil || !strings.Contains(err.Error(), "go-web") {
+		t.Fatalf("Should have listed known templates: %v", err)
+	}
+
+	outside := filepath.Join(filepath.Dir(dir), "outside.json")
+	if err := ioutil.WriteFile(outside, []byte(custom), 0644); err != nil {
+		t.Fatalf("Should have written file: %q", err.Error())
+	}
+
+	defer os.Remove(outside)
+
+	for _, name := range []string{"../outside", "a/b", ""} {
+		if _, err := loadTemplate(name); err == nil || !strings.Contains(err.Error(), "Invalid template name") {
+			t.Fatalf("Should have refused template name %q: %v", name, err)
+		}
+	}
+}
+
+func TestDetectTemplate(t *testing.T) {
+	project := func(files map[string]string) string {
+		dir := t.TempDir()
+
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("Should have created dir: %q", err.Error())
+			}
+
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("Should have written file: %q", err.Error())
+			}
+		}
+
+		return detectTemplate(dir)
+	}
+
+	cases := []struct {
+		files map[string]string
+		want  string
+	}{
+		{map[string]string{"go.mod": "module app\n"}, "go-web"},
+		{map[string]string{"go.mod": "module app\nrequire github.com/gopherjs/gopherjs v1.17.2\n"}, "gopherjs"},
+		{map[string]string{"package.json": "{}"}, "node"},
+		{map[string]string{"public/index.html": "<html></html>"}, "static-site"},
+		{map[string]string{"go.mod": "module app\n", "package.json": "{}"}, "go-web"},
+		{nil, "default"},
+	}
+
+	for _, c := range cases {
+		if got := project(c.files); got != c.want {
+			t.Fatalf("Should have detected %q template for %v: %q", c.want, c.files, got)
+		}
+	}
+}